@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/dedis/purb/purbs"
+	"gopkg.in/dedis/kyber.v2/util/random"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Name of the standard input or output in the file flags
+const STDIO = "-"
+
+var paramsFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "profile",
+		Value: purbs.PROFILE_CURVE25519_ONLY_V1,
+		Usage: "built-in parameters profile, see the params command",
+	},
+	cli.StringFlag{
+		Name:  "params",
+		Usage: "JSON file with the public parameters, instead of a profile",
+	},
+}
+
+var passphraseFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "passphrase-env",
+		Usage: "environment variable holding the passphrase of the private keys",
+	},
+	cli.StringFlag{
+		Name:  "passphrase-file",
+		Usage: "file holding the passphrase of the private keys, on its first line",
+	},
+}
+
+var inOutFlags = []cli.Flag{
+	cli.StringFlag{Name: "in", Value: STDIO, Usage: "input file, - for the standard input"},
+	cli.StringFlag{Name: "out", Value: STDIO, Usage: "output file, - for the standard output"},
+}
+
+func main() {
+	newApp().Run(os.Args)
+}
+
+// newApp returns the command-line application, with all its commands
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "purb"
+	app.Usage = "encrypt and decrypt Padded Uniform Random Blobs"
+	app.Version = "0.1"
+	app.Commands = []cli.Command{
+		{
+			Name:      "keygen",
+			Aliases:   []string{"k"},
+			Usage:     "generates an identity, and writes its public key to the standard output",
+			ArgsUsage: "IDENTITY_FILE",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{Name: "suite", Value: purbs.SUITE_CURVE25519, Usage: "registered suite of the key"},
+				cli.StringFlag{Name: "label", Usage: "label of the key, e.g., its owner"},
+				cli.BoolFlag{Name: "binary", Usage: "write the compact binary form instead of text"},
+			}, passphraseFlags...),
+			Action: keygen,
+		},
+		{
+			Name:    "encrypt",
+			Aliases: []string{"e"},
+			Usage:   "encrypts the input for the recipients of the public key files",
+			Flags: append(append([]cli.Flag{
+				cli.StringSliceFlag{Name: "recipient, r", Usage: "public key file or keyring, can be repeated"},
+				cli.StringFlag{Name: "armor", Usage: "write the PURB as base64 or base32 text"},
+				cli.BoolFlag{Name: "layout", Usage: "print the layout of the PURB to the standard error"},
+			}, paramsFlags...), inOutFlags...),
+			Action: encrypt,
+		},
+		{
+			Name:    "decrypt",
+			Aliases: []string{"d"},
+			Usage:   "decrypts the input, raw or armored, with the identity files",
+			Flags: append(append(append([]cli.Flag{
+				cli.StringSliceFlag{Name: "identity, i", Usage: "identity file or keyring, can be repeated"},
+			}, paramsFlags...), passphraseFlags...), inOutFlags...),
+			Action: decrypt,
+		},
+		{
+			Name:    "inspect",
+			Aliases: []string{"i"},
+			Usage:   "prints what a decoder sees of the input: its length, the allowed positions it covers, and with identities, what they decode",
+			Flags: append(append(append([]cli.Flag{
+				cli.StringSliceFlag{Name: "identity, i", Usage: "identity file or keyring, can be repeated"},
+			}, paramsFlags...), passphraseFlags...), inOutFlags[0]),
+			Action: inspect,
+		},
+		{
+			Name:      "params",
+			Aliases:   []string{"p"},
+			Usage:     "lists the profiles, or prints and validates a profile or a parameters file",
+			ArgsUsage: "[PROFILE]",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "params", Usage: "JSON file with the public parameters to validate"},
+			},
+			Action: params,
+		},
+	}
+	return app
+}
+
+func keygen(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.NewExitError("usage: keygen [--suite S] [--label L] [--binary] IDENTITY_FILE", 1)
+	}
+	passphrase, err := readPassphrase(c)
+	if err != nil {
+		return exitError(err)
+	}
+	format := purbs.KeyFormatText
+	if c.Bool("binary") {
+		format = purbs.KeyFormatBinary
+	}
+
+	identity, err := purbs.NewIdentity(c.String("suite"), c.String("label"))
+	if err != nil {
+		return exitError(err)
+	}
+	private, err := identity.Marshal(format, passphrase, random.New())
+	if err != nil {
+		return exitError(err)
+	}
+	if err := writeNewFile(c.Args().Get(0), private); err != nil {
+		return exitError(err)
+	}
+	public, err := identity.PublicKey.Marshal(format)
+	if err != nil {
+		return exitError(err)
+	}
+	return exitError(writeOutput(STDIO, public))
+}
+
+func encrypt(c *cli.Context) error {
+	// the PURBs of an unreleased profile may not decrypt with later versions
+	if c.String("params") == "" {
+		if released, err := purbs.ProfileReleased(c.String("profile")); err == nil && !released {
+			return cli.NewExitError(fmt.Sprintf("profile %v is unreleased, and cannot encrypt", c.String("profile")), 1)
+		}
+	}
+	parameters, err := loadParameters(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if len(c.StringSlice("recipient")) == 0 {
+		return cli.NewExitError("at least one recipient is needed", 1)
+	}
+	recipients := make([]purbs.Recipient, 0)
+	for _, path := range c.StringSlice("recipient") {
+		publicKeys, err := loadPublicKeys(path)
+		if err != nil {
+			return exitError(fmt.Errorf("%v: %v", path, err))
+		}
+		for _, publicKey := range publicKeys {
+			recipients = append(recipients, publicKey.Recipient())
+		}
+	}
+
+	data, err := readInput(c.String("in"))
+	if err != nil {
+		return exitError(err)
+	}
+	purb, err := purbs.Encode(data, recipients, random.New(), parameters, false)
+	if err != nil {
+		return exitError(err)
+	}
+	if c.Bool("layout") {
+		fmt.Fprintln(os.Stderr, purb.VisualRepresentation(false))
+	}
+
+	blob := purb.ToBytes()
+	switch c.String("armor") {
+	case "":
+	case "base64":
+		blob = []byte(purbs.ArmorEncode(blob, purbs.ArmorBase64))
+	case "base32":
+		blob = []byte(purbs.ArmorEncode(blob, purbs.ArmorBase32))
+	default:
+		return cli.NewExitError("--armor is base64 or base32", 1)
+	}
+	return exitError(writeOutput(c.String("out"), blob))
+}
+
+func decrypt(c *cli.Context) error {
+	parameters, identities, blob, err := decoderInputs(c, true)
+	if err != nil {
+		return exitError(err)
+	}
+	for _, identity := range identities {
+		recipient := identity.Recipient()
+		if _, found := parameters.SuiteInfoMap[recipient.SuiteName]; !found {
+			continue
+		}
+		success, message, err := purbs.Decode(blob, &recipient, parameters, false)
+		if err == nil && success {
+			return exitError(writeOutput(c.String("out"), message))
+		}
+	}
+	return cli.NewExitError("none of the identities can decrypt the input", 1)
+}
+
+func inspect(c *cli.Context) error {
+	parameters, identities, input, err := decoderInputs(c, false)
+	if err != nil {
+		return exitError(err)
+	}
+	blob := purbs.Unarmor(input)
+	if len(blob) != len(input) {
+		fmt.Printf("armored: %v characters\n", len(input))
+	}
+	fmt.Printf("length: %v bytes, nonce %v bytes, MAC %v bytes\n", len(blob), purbs.NONCE_LENGTH, purbs.MAC_AUTHENTICATION_TAG_LENGTH)
+
+	// the padding scheme rounds whole PURBs, so a PURB is always at one of its lengths
+	scheme := parameters.PaddingScheme
+	if scheme == nil {
+		scheme = purbs.PadmePadding{}
+	}
+	fmt.Printf("padding: %v, length allowed: %v\n", scheme, scheme.PaddedLength(len(blob)) == len(blob))
+
+	for _, suiteName := range sortedSuites(parameters) {
+		info := parameters.SuiteInfoMap[suiteName]
+		inside := make([]int, 0)
+		for _, position := range info.AllowedPositions {
+			if position < len(blob) {
+				inside = append(inside, position)
+			}
+		}
+		fmt.Printf("suite %v: cornerstone of %v bytes, XORed from the positions %v, entrypoints of %v bytes\n",
+			suiteName, info.CornerstoneLength, inside, info.EntryPointLength)
+	}
+
+	for _, identity := range identities {
+		recipient := identity.Recipient()
+		if _, found := parameters.SuiteInfoMap[recipient.SuiteName]; !found {
+			fmt.Printf("identity %q: suite %v is not in the parameters\n", identity.Label, recipient.SuiteName)
+			continue
+		}
+		success, message, err := purbs.Decode(blob, &recipient, parameters, false)
+		if err != nil || !success {
+			fmt.Printf("identity %q: cannot decode (%v)\n", identity.Label, err)
+			continue
+		}
+		fmt.Printf("identity %q: decodes a payload of %v bytes\n", identity.Label, len(message))
+	}
+	return nil
+}
+
+func params(c *cli.Context) error {
+	var parameters *purbs.PurbPublicFixedParameters
+	var err error
+	switch {
+	case c.String("params") != "":
+		parameters, err = purbs.LoadPublicParameters(c.String("params"))
+	case c.NArg() == 1:
+		parameters, err = purbs.ProfileParameters(c.Args().Get(0))
+	default:
+		for _, name := range purbs.ProfileNames() {
+			description, _ := purbs.ProfileDescription(name)
+			if released, _ := purbs.ProfileReleased(name); !released {
+				name += " (unreleased)"
+			}
+			fmt.Printf("%v: %v\n", name, description)
+		}
+		return nil
+	}
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := parameters.Write(os.Stdout); err != nil {
+		return exitError(err)
+	}
+	fingerprint, err := parameters.Fingerprint()
+	if err != nil {
+		return exitError(err)
+	}
+	fmt.Println("fingerprint:", fingerprint)
+	if err := parameters.CheckSuites(); err != nil {
+		fmt.Println("suites:", err)
+	}
+	report := parameters.Validate()
+	fmt.Println("validation:", report)
+	return exitError(report.Err())
+}
+
+// decoderInputs loads the parameters, the identities and the input of decrypt and inspect
+func decoderInputs(c *cli.Context, needIdentities bool) (*purbs.PurbPublicFixedParameters, []*purbs.Identity, []byte, error) {
+	parameters, err := loadParameters(c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	passphrase, err := readPassphrase(c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	identities := make([]*purbs.Identity, 0)
+	for _, path := range c.StringSlice("identity") {
+		loaded, err := loadIdentities(path, passphrase)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%v: %v", path, err)
+		}
+		identities = append(identities, loaded...)
+	}
+	if len(identities) == 0 && needIdentities {
+		return nil, nil, nil, errors.New("at least one identity is needed")
+	}
+	input, err := readInput(c.String("in"))
+	return parameters, identities, input, err
+}
+
+// loadParameters loads the parameters of a profile or a file, and checks them: a file may come from anywhere, and
+// parameters which are not valid make the encoder and the decoder fail
+func loadParameters(c *cli.Context) (*purbs.PurbPublicFixedParameters, error) {
+	var parameters *purbs.PurbPublicFixedParameters
+	var err error
+	if path := c.String("params"); path != "" {
+		parameters, err = purbs.LoadPublicParameters(path)
+	} else {
+		parameters, err = purbs.ProfileParameters(c.String("profile"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := parameters.CheckSuites(); err != nil {
+		return nil, err
+	}
+	if err := parameters.Validate().Err(); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
+
+// loadPublicKeys reads a key file, in binary form, or a keyring in text form
+func loadPublicKeys(path string) ([]*purbs.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[0] == purbs.PUBLIC_KEY_BINARY_TYPE {
+		publicKey, err := purbs.ParsePublicKey(data)
+		return []*purbs.PublicKey{publicKey}, err
+	}
+	return purbs.ParsePublicKeys(data)
+}
+
+// loadIdentities reads an identity file, in binary form, or a keyring in text form
+func loadIdentities(path string, passphrase []byte) ([]*purbs.Identity, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && (data[0] == purbs.IDENTITY_BINARY_TYPE || data[0] == purbs.IDENTITY_ENCRYPTED_BINARY_TYPE) {
+		identity, err := purbs.ParseIdentity(data, passphrase)
+		return []*purbs.Identity{identity}, err
+	}
+	return purbs.ParseIdentities(data, passphrase)
+}
+
+func readPassphrase(c *cli.Context) ([]byte, error) {
+	if name := c.String("passphrase-env"); name != "" {
+		passphrase, found := os.LookupEnv(name)
+		if !found {
+			return nil, fmt.Errorf("environment variable %v is not set", name)
+		}
+		return []byte(passphrase), nil
+	}
+	if path := c.String("passphrase-file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(bytes.SplitN(data, []byte("\n"), 2)[0], "\r"), nil
+	}
+	return nil, nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == STDIO {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == STDIO {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// writeNewFile writes a file readable by its owner only, and never overwrites an existing one
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sortedSuites(parameters *purbs.PurbPublicFixedParameters) []string {
+	names := make([]string, 0, len(parameters.SuiteInfoMap))
+	for name := range parameters.SuiteInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exitError turns an error into the exit status of the command, and nil into success
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return cli.NewExitError(err.Error(), 1)
+}
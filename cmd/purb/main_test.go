@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dedis/purb/purbs"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestKeygenEncryptDecrypt(t *testing.T) {
+	// errors are returned by Run, instead of exiting
+	exitCode := 0
+	cli.OsExiter = func(code int) { exitCode = code }
+	cli.ErrWriter = ioutil.Discard
+	defer func() { cli.OsExiter, cli.ErrWriter = os.Exit, os.Stderr }()
+
+	dir, err := ioutil.TempDir("", "purb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	run := func(args ...string) error {
+		return newApp().Run(append([]string{"purb"}, args...))
+	}
+	require.NoError(t, ioutil.WriteFile(path("passphrase"), []byte("correct horse battery staple\n"), 0600))
+
+	require.NoError(t, run("keygen", "--label", "alice", "--passphrase-file", path("passphrase"), path("alice.id")))
+	info, err := os.Stat(path("alice.id"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// keygen prints the public key, which is also in the identity file
+	identities, err := loadIdentities(path("alice.id"), []byte("correct horse battery staple"))
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	public, err := identities[0].PublicKey.Marshal(purbs.KeyFormatText)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path("alice.pub"), public, 0644))
+
+	// an existing identity is never overwritten
+	before, err := ioutil.ReadFile(path("alice.id"))
+	require.NoError(t, err)
+	require.Error(t, run("keygen", path("alice.id")))
+	require.Equal(t, 1, exitCode)
+	after, err := ioutil.ReadFile(path("alice.id"))
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	data := []byte("SomeInfo")
+	require.NoError(t, ioutil.WriteFile(path("message"), data, 0600))
+	for _, armor := range []string{"", "base64"} {
+		require.NoError(t, run("encrypt", "-r", path("alice.pub"), "--armor", armor, "--in", path("message"), "--out", path("purb")))
+		require.NoError(t, run("decrypt", "-i", path("alice.id"), "--passphrase-file", path("passphrase"), "--in", path("purb"), "--out", path("decrypted")))
+		decrypted, err := ioutil.ReadFile(path("decrypted"))
+		require.NoError(t, err)
+		require.Equal(t, data, decrypted)
+		info, err := os.Stat(path("decrypted"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		require.NoError(t, os.Remove(path("decrypted")))
+	}
+
+	// without the passphrase, the identity cannot decrypt
+	require.Error(t, run("decrypt", "-i", path("alice.id"), "--in", path("purb"), "--out", path("decrypted")))
+
+	// parameters are checked before use
+	require.Error(t, run("encrypt", "-r", path("alice.pub"), "--profile", purbs.PROFILE_MULTI_SUITE_V1, "--in", path("message"), "--out", path("purb")))
+	for _, change := range []func(*purbs.SuiteInfo){
+		func(info *purbs.SuiteInfo) { info.AllowedPositions = []int{} },
+		func(info *purbs.SuiteInfo) { info.CornerstoneLength = 16 },
+	} {
+		parameters, err := purbs.ProfileParameters(purbs.PROFILE_CURVE25519_ONLY_V1)
+		require.NoError(t, err)
+		change(parameters.SuiteInfoMap[purbs.SUITE_CURVE25519])
+		require.NoError(t, parameters.Save(path("params.json")))
+		require.Error(t, run("encrypt", "-r", path("alice.pub"), "--params", path("params.json"), "--in", path("message"), "--out", path("purb")))
+		require.Error(t, run("decrypt", "-i", path("alice.id"), "--passphrase-file", path("passphrase"), "--params", path("params.json"), "--in", path("purb"), "--out", path("decrypted")))
+	}
+}
@@ -7,12 +7,12 @@ import sys
 from utils import *
 
 # colors and constants
-colors = ['#E2DC27', '#071784', '#077C0F', '#BC220A']
-devcolors = ['#FFFDCD', '#CDE1FF', '#D4FFE3', '#FFDFD1']
+colors = ['#E2DC27', '#071784', '#077C0F', '#BC220A', '#7B1FA2']
+devcolors = ['#FFFDCD', '#CDE1FF', '#D4FFE3', '#FFDFD1', '#EBD4F5']
 # barcolors = ['#c2c0bf', '#FFFDCD', '#CDE1FF', '#FFDFD1', '#D4FFE3']
 barcolors = ['#EBEBEB', '#FFE5CC', '#CCE5FF', ]
-markers = ['d', 's', 'x', '.']
-linestyles = ['--', ':', '-', '-.']
+markers = ['d', 's', 'x', '.', 'o']
+linestyles = ['--', ':', '-', '-.', '-']
 patterns = ['', '.', '//']
 
 
@@ -23,6 +23,7 @@ def plotHeaderSize():
     labels = {}
     labels['purb-flat'] = 'PURBs flat'
     labels['purb'] = 'PURBs'
+    labels['purb-cuckoo'] = 'PURBs cuckoo'
     i = 0
     for header_sizes_type in header_sizes:
         data = header_sizes[header_sizes_type]
@@ -90,6 +91,7 @@ def plotDecodeTime():
     labels['pgp-hidden'] = 'PGP hidden'
     labels['purb-flat'] = 'PURBs flat'
     labels['purb'] = 'PURBs standard'
+    labels['purb-cuckoo'] = 'PURBs cuckoo'
 
     i = 0
     for decode_type in decode:
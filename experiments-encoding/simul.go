@@ -17,6 +17,7 @@ const RECIPIENTS_ENCODING_STR = "1,3,10,100" //100,1000,10000"
 const RECIPIENTS_DECODING_STR = "1,10,100,1000,10000"
 const SUITES_ENCODING_STR = "1,3,10"
 const SUITES_DECODING_STR = "1"
+const SUITES_POSITIONS_STR = "1,2,3,4,5,6"
 
 func main() {
 	app := cli.NewApp()
@@ -43,6 +44,11 @@ func main() {
 			Aliases: []string{"c"},
 			Action: headerCompactness,
 		},
+		{
+			Name: "positions",
+			Aliases: []string{"p"},
+			Action: allowedPositions,
+		},
 	}
 	app.Run(os.Args)
 }
@@ -95,6 +101,17 @@ func headerCompactness(c *cli.Context){
 	fmt.Println(out)
 }
 
+func allowedPositions(c *cli.Context){
+	l := log.New(os.Stderr, "", 0)
+
+	suites := toIntArray(SUITES_POSITIONS_STR)
+
+	l.Println("-------------------------------------------------------")
+	l.Println("Computing expected header size of hand-made and generated allowed positions for various number of suites")
+	out := purbs.SimulMeasureAllowedPositions(suites)
+	fmt.Println(out)
+}
+
 func toIntArray(str string) []int {
 	parts := strings.Split(str, ",")
 	r := make([]int, len(parts))
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dedis/purb/leakage"
+	"github.com/dedis/purb/purbs"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Padmé's worst-case overhead, so that trained profiles can be compared to it
+const DEFAULT_MAX_OVERHEAD = 0.12
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "purbs padding"
+	app.Version = "0.1"
+	app.Commands = []cli.Command{
+		{
+			Name:    "leakage",
+			Aliases: []string{"l"},
+			Usage:   "overhead and leakage of the padding schemes over the *.sizes datasets",
+			Action:  analyzeLeakage,
+		},
+		{
+			Name:      "train",
+			Aliases:   []string{"t"},
+			Usage:     "trains padding buckets on a sizes file, and writes them as a padding profile",
+			ArgsUsage: "SIZES_FILE PROFILE_FILE",
+			Flags: []cli.Flag{
+				cli.Float64Flag{
+					Name:  "max-overhead",
+					Value: DEFAULT_MAX_OVERHEAD,
+					Usage: "largest relative overhead of a size of the training set",
+				},
+				cli.IntFlag{
+					Name:  "offset",
+					Usage: "bytes added to every size before training: the buckets pad whole PURBs, header and MAC included",
+				},
+			},
+			Action: train,
+		},
+	}
+	app.Run(os.Args)
+}
+
+func analyzeLeakage(c *cli.Context) {
+	l := log.New(os.Stderr, "", 0)
+
+	files, err := filepath.Glob("*.sizes")
+	if err != nil {
+		l.Fatal(err)
+	}
+	schemes := []purbs.PaddingScheme{purbs.NoPadding{}, purbs.PadmePadding{}, purbs.PowerOfTwoPadding{}}
+
+	for _, file := range files {
+		distribution, err := leakage.LoadSizes(file)
+		if err != nil {
+			l.Fatal(err)
+		}
+		l.Println("-------------------------------------------------------")
+		l.Println("Computing the leakage of padding schemes over", file)
+		for _, scheme := range schemes {
+			fmt.Println(file, leakage.Analyze(distribution, scheme))
+		}
+	}
+}
+
+func train(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("usage: train [--max-overhead X] SIZES_FILE PROFILE_FILE", 1)
+	}
+	sizesFile, profileFile := c.Args().Get(0), c.Args().Get(1)
+
+	distribution, err := leakage.LoadSizes(sizesFile)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	distribution = distribution.Shift(c.Int("offset"))
+	name := strings.TrimSuffix(filepath.Base(sizesFile), ".sizes")
+	profile, err := leakage.TrainProfile(name, distribution, c.Float64("max-overhead"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if err := profile.Save(profileFile); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Println(sizesFile, leakage.Analyze(distribution, profile.Scheme()))
+	fmt.Println(sizesFile, leakage.Analyze(distribution, purbs.PadmePadding{}))
+	return nil
+}
@@ -0,0 +1,228 @@
+// Package leakage measures what a padding scheme hides, and what it costs, over a distribution of real object sizes
+// (e.g., the *.sizes datasets of experiments-padding): overhead percentiles, anonymity sets and bits of leakage.
+package leakage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/purb/purbs"
+)
+
+// Sizes below this are skipped when loading a distribution, as in the plotting scripts: the relative overhead of
+// padding them is meaningless
+const MIN_SIZE = 2
+
+// The percentiles of the overhead and of the anonymity sets given in a Report
+var REPORTED_PERCENTILES = []float64{1, 10, 50, 90, 99, 100}
+
+// A distribution of object sizes, in bytes, sorted increasingly
+type Distribution struct {
+	Sizes []int
+}
+
+// Shift returns the distribution of the sizes plus offset, e.g., of the PURBs encoding objects of these sizes
+func (distribution *Distribution) Shift(offset int) *Distribution {
+	sizes := make([]int, len(distribution.Sizes))
+	for i, size := range distribution.Sizes {
+		sizes[i] = size + offset
+	}
+	return &Distribution{Sizes: sizes}
+}
+
+// LoadSizes reads a distribution from a file with one size per line
+func LoadSizes(path string) (*Distribution, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSizes(f)
+}
+
+// ReadSizes reads a distribution with one size per line. Empty lines and sizes below MIN_SIZE are skipped
+func ReadSizes(r io.Reader) (*Distribution, error) {
+	sizes := make([]int, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		size, err := strconv.Atoi(text)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("line %v: invalid size %q", line, text)
+		}
+		if size >= MIN_SIZE {
+			sizes = append(sizes, size)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("no size in the distribution")
+	}
+	return NewDistribution(sizes), nil
+}
+
+// NewDistribution creates a distribution from some sizes (which are copied)
+func NewDistribution(sizes []int) *Distribution {
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	return &Distribution{Sizes: sorted}
+}
+
+// What a padding scheme costs and leaks over a distribution
+type Report struct {
+	Scheme  string
+	Objects int
+
+	MeanOverhead float64             // mean of (padded - size) / size
+	Overhead     map[float64]float64 // percentile -> relative overhead, for REPORTED_PERCENTILES
+
+	PaddedLengths int             // number of distinct padded lengths
+	Anonymity     map[float64]int // percentile -> size of the anonymity set of the objects, for REPORTED_PERCENTILES
+	SmallestSet   int             // size of the smallest anonymity set
+
+	LeakageBits float64 // log2(PaddedLengths), the most an observer can learn from a padded length
+	EntropyBits float64 // Shannon entropy of the padded length, what an observer learns on average
+}
+
+// Analyze pads every size of the distribution with the scheme. The anonymity set of an object is the set of objects
+// padded to the same length
+func Analyze(distribution *Distribution, scheme purbs.PaddingScheme) *Report {
+	n := len(distribution.Sizes)
+	report := &Report{
+		Scheme:    scheme.String(),
+		Objects:   n,
+		Overhead:  make(map[float64]float64),
+		Anonymity: make(map[float64]int),
+	}
+	if n == 0 {
+		return report
+	}
+
+	overheads := make([]float64, n)
+	sets := make(map[int]int) // padded length -> number of objects
+	for i, size := range distribution.Sizes {
+		padded := scheme.PaddedLength(size)
+		overheads[i] = float64(padded-size) / float64(size)
+		report.MeanOverhead += overheads[i] / float64(n)
+		sets[padded]++
+	}
+	sort.Float64s(overheads)
+
+	// each object counts once, so a set of k objects counts k times
+	anonymity := make([]int, 0, n)
+	for _, count := range sets {
+		for i := 0; i < count; i++ {
+			anonymity = append(anonymity, count)
+		}
+		p := float64(count) / float64(n)
+		report.EntropyBits -= p * math.Log2(p)
+	}
+	sort.Ints(anonymity)
+
+	for _, percentile := range REPORTED_PERCENTILES {
+		report.Overhead[percentile] = overheads[rank(percentile, n)]
+		report.Anonymity[percentile] = anonymity[rank(percentile, n)]
+	}
+	report.PaddedLengths = len(sets)
+	report.SmallestSet = anonymity[0]
+	report.LeakageBits = math.Log2(float64(len(sets)))
+	return report
+}
+
+// rank returns the index of the percentile in a sorted slice of n elements (nearest-rank method)
+func rank(percentile float64, n int) int {
+	i := int(math.Ceil(percentile/100*float64(n))) - 1
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+func (report *Report) String() string {
+	return fmt.Sprintf("%v: %v objects, mean overhead %.2f%%, p99 overhead %.2f%%, %v padded lengths, "+
+		"median anonymity set %v, smallest %v, leakage %.2f bits (entropy %.2f bits)",
+		report.Scheme, report.Objects, 100*report.MeanOverhead, 100*report.Overhead[99], report.PaddedLengths,
+		report.Anonymity[50], report.SmallestSet, report.LeakageBits, report.EntropyBits)
+}
+
+// Limits a Report must respect, e.g., in a CI check of a scheme against a traffic profile. Zero means no limit
+type Requirements struct {
+	MaxMeanOverhead    float64 // relative, e.g., 0.1 for 10%
+	MaxLeakageBits     float64
+	MinMedianAnonymity int
+}
+
+// Check returns an error listing the requirements the report does not meet, or nil
+func (report *Report) Check(requirements Requirements) error {
+	failures := make([]string, 0)
+	if requirements.MaxMeanOverhead > 0 && report.MeanOverhead > requirements.MaxMeanOverhead {
+		failures = append(failures, fmt.Sprintf("mean overhead %.2f%% above %.2f%%", 100*report.MeanOverhead, 100*requirements.MaxMeanOverhead))
+	}
+	if requirements.MaxLeakageBits > 0 && report.LeakageBits > requirements.MaxLeakageBits {
+		failures = append(failures, fmt.Sprintf("leakage %.2f bits above %.2f bits", report.LeakageBits, requirements.MaxLeakageBits))
+	}
+	if requirements.MinMedianAnonymity > 0 && report.Anonymity[50] < requirements.MinMedianAnonymity {
+		failures = append(failures, fmt.Sprintf("median anonymity set %v below %v", report.Anonymity[50], requirements.MinMedianAnonymity))
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v: %v", report.Scheme, strings.Join(failures, ", "))
+}
+
+// TrainBuckets computes padding buckets for the distribution such that no size is padded by more than maxOverhead
+// (relative), with as few buckets as possible, i.e., with the least leakage. Greedily, the smallest size not padded
+// yet opens a bucket at the largest size it can be padded to, which takes every size up to it; no set of buckets can
+// do with fewer. Each bucket is a size of the distribution, so that no object pays for lengths no object has.
+// The buckets pad the lengths of the distribution: as BucketsPadding pads whole PURBs, a distribution of plaintext
+// sizes should be shifted by the length the PURBs add to them (header, nonce and MAC) first, see Shift
+func TrainBuckets(distribution *Distribution, maxOverhead float64) ([]int, error) {
+	if maxOverhead < 0 {
+		return nil, fmt.Errorf("negative maximum overhead %v", maxOverhead)
+	}
+	if len(distribution.Sizes) == 0 {
+		return nil, errors.New("no size in the distribution")
+	}
+
+	buckets := make([]int, 0)
+	sizes := distribution.Sizes
+	for i := 0; i < len(sizes); {
+		limit := int(math.Floor(float64(sizes[i]) * (1 + maxOverhead)))
+		for i < len(sizes) && sizes[i] <= limit {
+			i++
+		}
+		buckets = append(buckets, sizes[i-1])
+	}
+	return buckets, nil
+}
+
+// TrainProfile computes the buckets of TrainBuckets, as a padding profile usable by encoders
+func TrainProfile(name string, distribution *Distribution, maxOverhead float64) (*purbs.PaddingProfile, error) {
+	buckets, err := TrainBuckets(distribution, maxOverhead)
+	if err != nil {
+		return nil, err
+	}
+	return &purbs.PaddingProfile{
+		Name:        name,
+		Objects:     len(distribution.Sizes),
+		MaxOverhead: maxOverhead,
+		Buckets:     buckets,
+	}, nil
+}
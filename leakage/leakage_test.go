@@ -0,0 +1,87 @@
+package leakage
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/dedis/purb/purbs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSizes(t *testing.T) {
+	distribution, err := ReadSizes(strings.NewReader("300\n\n1\n100\n0\n200\n"))
+	require.NoError(t, err)
+	require.Equal(t, []int{100, 200, 300}, distribution.Sizes)
+
+	_, err = ReadSizes(strings.NewReader("100\nabc\n"))
+	require.Error(t, err)
+	_, err = ReadSizes(strings.NewReader("1\n"))
+	require.Error(t, err)
+}
+
+func TestAnalyze(t *testing.T) {
+	distribution := NewDistribution([]int{100, 120, 128, 129, 250, 256})
+
+	// without padding, each object is alone
+	report := Analyze(distribution, purbs.NoPadding{})
+	require.Equal(t, 0.0, report.MeanOverhead)
+	require.Equal(t, 6, report.PaddedLengths)
+	require.Equal(t, 1, report.SmallestSet)
+	require.InDelta(t, math.Log2(6), report.LeakageBits, 1e-9)
+	require.InDelta(t, math.Log2(6), report.EntropyBits, 1e-9)
+
+	// powers of two: {100, 120, 128} -> 128, {129, 250, 256} -> 256
+	report = Analyze(distribution, purbs.PowerOfTwoPadding{})
+	require.Equal(t, 2, report.PaddedLengths)
+	require.Equal(t, 3, report.SmallestSet)
+	require.Equal(t, 3, report.Anonymity[50])
+	require.InDelta(t, 1.0, report.LeakageBits, 1e-9)
+	require.InDelta(t, 1.0, report.EntropyBits, 1e-9)
+	require.InDelta(t, float64(256-129)/129, report.Overhead[100], 1e-9)
+
+	require.NoError(t, report.Check(Requirements{MaxMeanOverhead: 0.5, MaxLeakageBits: 1, MinMedianAnonymity: 3}))
+	require.Error(t, report.Check(Requirements{MaxMeanOverhead: 0.01}))
+	require.Error(t, report.Check(Requirements{MinMedianAnonymity: 4}))
+}
+
+func TestPadmeLeaksLessThanNoPadding(t *testing.T) {
+	sizes := make([]int, 0)
+	for size := 1000; size < 100000; size += 37 {
+		sizes = append(sizes, size)
+	}
+	distribution := NewDistribution(sizes)
+
+	padme := Analyze(distribution, purbs.PadmePadding{})
+	none := Analyze(distribution, purbs.NoPadding{})
+	require.True(t, padme.LeakageBits < none.LeakageBits)
+	require.True(t, padme.Overhead[100] <= 0.12) // Padmé's overhead is at most 12%
+}
+
+func TestTrainBuckets(t *testing.T) {
+	distribution := NewDistribution([]int{100, 105, 110, 111, 200, 250, 1000})
+	buckets, err := TrainBuckets(distribution, 0.1)
+	require.NoError(t, err)
+	require.Equal(t, []int{110, 111, 200, 250, 1000}, buckets)
+
+	// the buckets pad the shifted sizes, e.g., those of whole PURBs
+	buckets, err = TrainBuckets(distribution.Shift(100), 0.1)
+	require.NoError(t, err)
+	require.Equal(t, []int{211, 300, 350, 1100}, buckets)
+
+	// no size is padded by more than the target, and the buckets leak less than Padmé at a similar cost
+	sizes := make([]int, 0)
+	for size := 1000; size < 1000000; size = size*101/100 + 7 {
+		sizes = append(sizes, size)
+	}
+	distribution = NewDistribution(sizes)
+	profile, err := TrainProfile("test", distribution, 0.12)
+	require.NoError(t, err)
+	trained := Analyze(distribution, profile.Scheme())
+	padme := Analyze(distribution, purbs.PadmePadding{})
+	require.True(t, trained.Overhead[100] <= 0.12)
+	require.True(t, trained.PaddedLengths <= padme.PaddedLengths)
+
+	_, err = TrainBuckets(distribution, -1)
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package purbs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Up to this number of suites, GenerateSuiteInfoMap tries every ordering of the suites; above, it improves an initial
+// ordering by swapping neighbours
+const MAX_SUITES_EXHAUSTIVE_ORDERING = 6
+
+// Popularity assumed for a suite whose SuiteDescription does not give one
+const DEFAULT_SUITE_POPULARITY = 0.5
+
+// Describes a suite for which AllowedPositions are to be generated
+type SuiteDescription struct {
+	Name              string
+	CornerstoneLength int
+	EntryPointLength  int
+	Popularity        float64 // probability that a PURB has recipients in this suite, in ]0, 1]. 0 means DEFAULT_SUITE_POPULARITY
+}
+
+// GenerateSuiteInfoMap computes AllowedPositions for the given suites, such that the cornerstones of *every* subset of
+// the suites can be placed, and such that the expected header length (see ExpectedHeaderLength) is as small as we can
+// find.
+//
+// For a given ordering of the suites, the k-th suite gets an exclusive position right after the exclusive positions of
+// the suites before it, plus every position aligned on its cornerstone length below it. For any subset, placing the
+// cornerstones in this order always works: the last one can fall back to its exclusive position, which lies beyond all
+// positions of the suites before it. The aligned positions let a suite move down when the suites before it are not
+// used. The ordering itself is then optimized: exhaustively for up to MAX_SUITES_EXHAUSTIVE_ORDERING suites, by local
+// search otherwise. Every subset is verified with the placement solver when evaluating an ordering.
+func GenerateSuiteInfoMap(suites []SuiteDescription) (SuiteInfoMap, error) {
+	if err := checkSuiteDescriptions(suites); err != nil {
+		return nil, err
+	}
+
+	// initial ordering: popular suites first, then short cornerstones first, so that they end up at small offsets
+	order := make([]int, len(suites))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := suites[order[i]], suites[order[j]]
+		if a.popularity() != b.popularity() {
+			return a.popularity() > b.popularity()
+		}
+		if a.CornerstoneLength != b.CornerstoneLength {
+			return a.CornerstoneLength < b.CornerstoneLength
+		}
+		return a.Name < b.Name
+	})
+
+	bestOrder := append([]int{}, order...)
+	bestLength, err := ExpectedHeaderLength(allowedPositionsForOrdering(suites, order), suites)
+	if err != nil {
+		return nil, err
+	}
+
+	try := func(candidate []int) bool {
+		length, err := ExpectedHeaderLength(allowedPositionsForOrdering(suites, candidate), suites)
+		if err != nil || length >= bestLength {
+			return false
+		}
+		bestLength = length
+		copy(bestOrder, candidate)
+		return true
+	}
+
+	if len(suites) <= MAX_SUITES_EXHAUSTIVE_ORDERING {
+		permutations(order, func(candidate []int) {
+			try(candidate)
+		})
+	} else {
+		for improved := true; improved; {
+			improved = false
+			for i := 0; i+1 < len(bestOrder); i++ {
+				candidate := append([]int{}, bestOrder...)
+				candidate[i], candidate[i+1] = candidate[i+1], candidate[i]
+				if try(candidate) {
+					improved = true
+				}
+			}
+		}
+	}
+
+	return allowedPositionsForOrdering(suites, bestOrder), nil
+}
+
+// ExpectedHeaderLength returns the expected length of a header when using these suites, each suite being used
+// independently with its Popularity. For each subset of suites, the length is the one of the optimal cornerstone
+// placement, or the nonce followed by one cornerstone and one entrypoint per suite if this is longer (i.e., assuming one
+// recipient per suite, and entrypoints packed around the cornerstones). It fails if some subset cannot be placed.
+func ExpectedHeaderLength(infoMap SuiteInfoMap, suites []SuiteDescription) (float64, error) {
+	if err := checkSuiteDescriptions(suites); err != nil {
+		return 0, err
+	}
+
+	problem := &placementProblem{suites: make([]*SuiteInfo, len(suites))}
+	for i, suite := range suites {
+		problem.suites[i] = infoMap[suite.Name]
+		if problem.suites[i] == nil {
+			return 0, fmt.Errorf("no SuiteInfo for suite %v", suite.Name)
+		}
+	}
+	table := problem.table()
+
+	expected := float64(0)
+	totalWeight := float64(0)
+	for set := 1; set < len(table.best); set++ {
+		if table.best[set] == infeasiblePlacement {
+			names := make([]string, 0)
+			for i, suite := range suites {
+				if set&(1<<uint(i)) != 0 {
+					names = append(names, suite.Name)
+				}
+			}
+			return 0, fmt.Errorf("%w: suites %v", ErrNoCornerstonePlacement, names)
+		}
+
+		weight := float64(1)
+		for i, suite := range suites {
+			if set&(1<<uint(i)) != 0 {
+				weight *= suite.popularity()
+			} else {
+				weight *= 1 - suite.popularity()
+			}
+		}
+
+		length := table.best[set]
+		if packed := packedHeaderLength(problem.suites, uint64(set)); packed > length {
+			length = packed
+		}
+		expected += weight * float64(length)
+		totalWeight += weight
+	}
+
+	return expected / totalWeight, nil
+}
+
+// allowedPositionsForOrdering builds the AllowedPositions for this ordering of the suites (see GenerateSuiteInfoMap)
+func allowedPositionsForOrdering(suites []SuiteDescription, order []int) SuiteInfoMap {
+	infoMap := make(SuiteInfoMap)
+	exclusive := NONCE_LENGTH
+	for _, index := range order {
+		suite := suites[index]
+		positions := make([]int, 0)
+		for pos := NONCE_LENGTH; pos+suite.CornerstoneLength <= exclusive; pos += suite.CornerstoneLength {
+			positions = append(positions, pos)
+		}
+		positions = append(positions, exclusive)
+		exclusive += suite.CornerstoneLength
+
+		infoMap[suite.Name] = &SuiteInfo{
+			AllowedPositions:  positions,
+			CornerstoneLength: suite.CornerstoneLength,
+			EntryPointLength:  suite.EntryPointLength,
+		}
+	}
+	return infoMap
+}
+
+func checkSuiteDescriptions(suites []SuiteDescription) error {
+	if len(suites) == 0 {
+		return errors.New("no suites given")
+	}
+	if len(suites) > MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT {
+		return fmt.Errorf("cannot verify the placement of more than %v suites", MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT)
+	}
+	names := make(map[string]bool)
+	for _, suite := range suites {
+		if suite.Name == "" {
+			return errors.New("suite without a name")
+		}
+		if names[suite.Name] {
+			return fmt.Errorf("suite %v given twice", suite.Name)
+		}
+		names[suite.Name] = true
+		if suite.CornerstoneLength <= 0 {
+			return fmt.Errorf("suite %v: cornerstone length must be positive", suite.Name)
+		}
+		if suite.EntryPointLength < 0 {
+			return fmt.Errorf("suite %v: entrypoint length cannot be negative", suite.Name)
+		}
+		if suite.Popularity < 0 || suite.Popularity > 1 {
+			return fmt.Errorf("suite %v: popularity must be in [0, 1]", suite.Name)
+		}
+	}
+	return nil
+}
+
+func (suite SuiteDescription) popularity() float64 {
+	if suite.Popularity == 0 {
+		return DEFAULT_SUITE_POPULARITY
+	}
+	return suite.Popularity
+}
+
+// permutations calls f on every permutation of "elements" (Heap's algorithm). f must not keep the slice
+func permutations(elements []int, f func([]int)) {
+	current := append([]int{}, elements...)
+	var generate func(k int)
+	generate = func(k int) {
+		if k <= 1 {
+			f(current)
+			return
+		}
+		for i := 0; i < k-1; i++ {
+			generate(k - 1)
+			if k%2 == 0 {
+				current[i], current[k-1] = current[k-1], current[i]
+			} else {
+				current[0], current[k-1] = current[k-1], current[0]
+			}
+		}
+		generate(k - 1)
+	}
+	generate(len(current))
+}
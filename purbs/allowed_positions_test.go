@@ -0,0 +1,106 @@
+package purbs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestGenerateSuiteInfoMap(t *testing.T) {
+	suites := realSuiteDescriptions()
+
+	infoMap, err := GenerateSuiteInfoMap(suites)
+	require.NoError(t, err)
+	require.Len(t, infoMap, len(suites))
+	for _, suite := range suites {
+		info := infoMap[suite.Name]
+		require.NotNil(t, info)
+		require.Equal(t, suite.CornerstoneLength, info.CornerstoneLength)
+		require.Equal(t, suite.EntryPointLength, info.EntryPointLength)
+	}
+
+	// every subset can be placed, and we do at least as well as the hand-made positions
+	generated, err := ExpectedHeaderLength(infoMap, suites)
+	require.NoError(t, err)
+	handmade, err := ExpectedHeaderLength(realSuiteInfoMap(), suites)
+	require.NoError(t, err)
+	require.True(t, generated <= handmade, "generated %v, hand-made %v", generated, handmade)
+
+	// the header can never be shorter than the cornerstones and entrypoints it contains
+	// (the empty subset is not counted, hence the normalization)
+	contents := float64(0)
+	for _, suite := range suites {
+		contents += DEFAULT_SUITE_POPULARITY * float64(suite.CornerstoneLength+suite.EntryPointLength)
+	}
+	nonEmpty := 1 - 1/float64(int(1)<<uint(len(suites)))
+	require.True(t, generated >= float64(NONCE_LENGTH)+contents/nonEmpty)
+}
+
+func TestGenerateSuiteInfoMapPopularity(t *testing.T) {
+	// a popular suite gets the first position
+	suites := []SuiteDescription{
+		{Name: "rare", CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH, Popularity: 0.1},
+		{Name: "popular", CornerstoneLength: 64, EntryPointLength: ENTRYPOINT_LENGTH, Popularity: 0.9},
+	}
+	infoMap, err := GenerateSuiteInfoMap(suites)
+	require.NoError(t, err)
+	require.Equal(t, []int{NONCE_LENGTH}, infoMap["popular"].AllowedPositions)
+}
+
+func TestGenerateSuiteInfoMapLocalSearch(t *testing.T) {
+	suites := make([]SuiteDescription, 0)
+	for i, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		suites = append(suites, SuiteDescription{
+			Name:              name,
+			CornerstoneLength: 32 * (1 + i%2),
+			EntryPointLength:  ENTRYPOINT_LENGTH,
+		})
+	}
+	infoMap, err := GenerateSuiteInfoMap(suites)
+	require.NoError(t, err)
+	_, err = ExpectedHeaderLength(infoMap, suites)
+	require.NoError(t, err)
+}
+
+func TestGenerateSuiteInfoMapErrors(t *testing.T) {
+	_, err := GenerateSuiteInfoMap(nil)
+	require.Error(t, err)
+	_, err = GenerateSuiteInfoMap([]SuiteDescription{{Name: "a", CornerstoneLength: 0}})
+	require.Error(t, err)
+	_, err = GenerateSuiteInfoMap([]SuiteDescription{{Name: "a", CornerstoneLength: 32}, {Name: "a", CornerstoneLength: 32}})
+	require.Error(t, err)
+	_, err = GenerateSuiteInfoMap([]SuiteDescription{{Name: "a", CornerstoneLength: 32, Popularity: 2}})
+	require.Error(t, err)
+
+	// hand-made positions which do not work for every subset
+	suites := []SuiteDescription{{Name: "a", CornerstoneLength: 32}, {Name: "b", CornerstoneLength: 32}}
+	infoMap := SuiteInfoMap{
+		"a": {AllowedPositions: []int{NONCE_LENGTH}, CornerstoneLength: 32},
+		"b": {AllowedPositions: []int{NONCE_LENGTH}, CornerstoneLength: 32},
+	}
+	_, err = ExpectedHeaderLength(infoMap, suites)
+	require.True(t, errors.Is(err, ErrNoCornerstonePlacement))
+}
+
+func TestEncodeWithGeneratedPositions(t *testing.T) {
+	suites := make([]SuiteDescription, 0)
+	for name := range getDummySuiteInfo(3) {
+		suites = append(suites, SuiteDescription{Name: name, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH})
+	}
+	infoMap, err := GenerateSuiteInfoMap(suites)
+	require.NoError(t, err)
+
+	data := []byte("SomeInfo")
+	params := NewPublicFixedParameters(infoMap, false)
+	recipients := createRecipients(2, 3, infoMap)
+	purb, err := Encode(data, recipients, random.New(), params, false)
+	require.NoError(t, err)
+	for _, recipient := range recipients {
+		success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+}
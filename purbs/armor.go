@@ -0,0 +1,113 @@
+package purbs
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Text encodings of a PURB, for channels where binary breaks, such as chats and email bodies. Unlike PGP armor, the
+// text has no header and no checksum: these would tell PURBs apart from any other base64 or base32 text
+type ArmorEncoding int
+
+const (
+	// Standard base64 (RFC 4648), with padding
+	ArmorBase64 ArmorEncoding = iota
+	// Standard base32 (RFC 4648), with padding: longer, but only upper-case letters and digits
+	ArmorBase32
+)
+
+// Length of the lines of an armored PURB
+const ARMOR_LINE_LENGTH = 64
+
+// ArmorEncode encodes a blob as text, in lines of ARMOR_LINE_LENGTH characters
+func ArmorEncode(blob []byte, encoding ArmorEncoding) string {
+	var text string
+	if encoding == ArmorBase32 {
+		text = base32.StdEncoding.EncodeToString(blob)
+	} else {
+		text = base64.StdEncoding.EncodeToString(blob)
+	}
+
+	lines := make([]string, 0, len(text)/ARMOR_LINE_LENGTH+1)
+	for len(text) > ARMOR_LINE_LENGTH {
+		lines = append(lines, text[:ARMOR_LINE_LENGTH])
+		text = text[ARMOR_LINE_LENGTH:]
+	}
+	if len(text) > 0 {
+		lines = append(lines, text)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ArmorDecode decodes the output of ArmorEncode with the same encoding. Whitespace is ignored, as clients re-wrap
+// lines; otherwise, the text must be exactly the encoding of a blob
+func ArmorDecode(armored string, encoding ArmorEncoding) ([]byte, error) {
+	text := strings.Map(func(r rune) rune {
+		if isArmorWhitespace(r) {
+			return -1
+		}
+		return r
+	}, armored)
+
+	if blob, ok := decodeCanonical(text, encoding); ok {
+		return blob, nil
+	}
+	return nil, errors.New("not an armored PURB")
+}
+
+// Unarmor returns the blob armored in input if there is one, and input otherwise. It lets decoders take PURBs either
+// raw or armored: a raw PURB is random, so it is not base64 text but with negligible probability. The base32 alphabet
+// is part of the base64 one, so some texts (e.g., short ones) read in both encodings; Unarmor then returns the base64
+// reading, while Decode tries both, and keeps the one whose MAC is valid
+func Unarmor(input []byte) []byte {
+	return unarmorCandidates(input)[0]
+}
+
+// unarmorCandidates returns the blobs input can be the armor of, base64 first, or input itself if there is none
+func unarmorCandidates(input []byte) [][]byte {
+	for _, b := range input {
+		if !isArmorWhitespace(rune(b)) && !strings.ContainsRune(armorAlphabet, rune(b)) {
+			return [][]byte{input}
+		}
+	}
+	candidates := make([][]byte, 0, 2)
+	for _, encoding := range []ArmorEncoding{ArmorBase64, ArmorBase32} {
+		if blob, err := ArmorDecode(string(input), encoding); err == nil {
+			candidates = append(candidates, blob)
+		}
+	}
+	if len(candidates) == 0 {
+		return [][]byte{input}
+	}
+	return candidates
+}
+
+// The characters of base64 text, which include those of base32 text
+const armorAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+
+func isArmorWhitespace(r rune) bool {
+	return r == '\n' || r == '\r' || r == ' ' || r == '\t'
+}
+
+// decodeCanonical decodes the text if it is the exact encoding of some blob, i.e., if encoding the blob gives it back
+func decodeCanonical(text string, encoding ArmorEncoding) ([]byte, bool) {
+	var blob []byte
+	var err error
+	var reencoded string
+	if encoding == ArmorBase32 {
+		blob, err = base32.StdEncoding.DecodeString(text)
+		reencoded = base32.StdEncoding.EncodeToString(blob)
+	} else {
+		blob, err = base64.StdEncoding.DecodeString(text)
+		reencoded = base64.StdEncoding.EncodeToString(blob)
+	}
+	if err != nil || reencoded != text {
+		return nil, false
+	}
+	return blob, true
+}
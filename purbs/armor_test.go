@@ -0,0 +1,99 @@
+package purbs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestArmor(t *testing.T) {
+	for _, encoding := range []ArmorEncoding{ArmorBase64, ArmorBase32} {
+		for _, length := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 32, 33, 34, 35, 100, 1000} {
+			blob := getRandomBytes(length)
+			armored := ArmorEncode(blob, encoding)
+			for _, line := range strings.Split(strings.TrimSuffix(armored, "\n"), "\n") {
+				require.True(t, len(line) <= ARMOR_LINE_LENGTH)
+			}
+
+			decoded, err := ArmorDecode(armored, encoding)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(blob, decoded))
+
+			// re-wrapped by a mail client
+			decoded, err = ArmorDecode(strings.Replace(armored, "\n", "\r\n  ", -1), encoding)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(blob, decoded))
+
+			// whatever else it reads as, the blob is among the candidates of the decoders
+			require.Contains(t, unarmorCandidates([]byte(armored)), blob)
+		}
+	}
+
+	// base64 text which is also base32 text, of another blob
+	armored := ArmorEncode(make([]byte, 6), ArmorBase64)
+	require.Equal(t, "AAAAAAAA\n", armored)
+	decoded, err := ArmorDecode(armored, ArmorBase64)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 6), decoded)
+	require.Equal(t, make([]byte, 6), Unarmor([]byte(armored)))
+	require.Equal(t, [][]byte{make([]byte, 6), make([]byte, 5)}, unarmorCandidates([]byte(armored)))
+}
+
+func TestArmorStrict(t *testing.T) {
+	armored := ArmorEncode(getRandomBytes(100), ArmorBase64)
+	for _, invalid := range []string{
+		armored + "A",
+		"-----BEGIN PURB-----\n" + armored,
+		strings.Replace(armored, "=", "", -1),
+		"QR==", // non-zero padding bits
+	} {
+		_, err := ArmorDecode(invalid, ArmorBase64)
+		require.Error(t, err)
+	}
+}
+
+func TestDecodeArmored(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(1, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	purb, err := Encode(data, recipients, random.New(), params, false)
+	require.NoError(t, err)
+	blob := purb.ToBytes()
+	require.Equal(t, blob, Unarmor(blob))
+
+	for _, encoding := range []ArmorEncoding{ArmorBase64, ArmorBase32} {
+		success, message, err := Decode([]byte(ArmorEncode(blob, encoding)), &recipients[0], params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+}
+
+func TestDecodeShortInputs(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(1, 1, infoMap)
+	for _, params := range []*PurbPublicFixedParameters{
+		NewPublicFixedParameters(infoMap, false),
+		NewPublicFixedParameters(infoMap, true),
+		NewCuckooPublicFixedParameters(infoMap, 4),
+	} {
+		for _, length := range []int{0, 5, 40} {
+			blob := getRandomBytes(length)
+			for _, input := range [][]byte{blob, []byte(ArmorEncode(blob, ArmorBase64))} {
+				success, _, err := Decode(input, &recipients[0], params, false)
+				require.False(t, success)
+				require.Equal(t, ErrBlobTooShort, err)
+			}
+
+			// base32 text also reads as (longer) base64
+			success, _, err := Decode([]byte(ArmorEncode(blob, ArmorBase32)), &recipients[0], params, false)
+			require.False(t, success)
+			require.Error(t, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package purbs
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+// EncodeBatch encodes messages[i] for recipientsPerMessage[i], and pads all the PURBs to the same length, so that their
+// sizes do not tell them apart. The common length is the smallest one allowed by the padding scheme which fits every
+// PURB and keeps each MAC off the allowed positions of the PURB's cornerstones. It returns the PURBs and their length
+func EncodeBatch(messages [][]byte, recipientsPerMessage [][]Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, options *EncoderOptions, verbose bool) ([]*EncodedPurb, int, error) {
+	if len(messages) != len(recipientsPerMessage) {
+		return nil, 0, errors.New("there must be one list of recipients per message")
+	}
+
+	purbs := make([]*Purb, 0, len(messages))
+	defer func() {
+		for _, purb := range purbs {
+			purb.wipeSecrets()
+		}
+	}()
+
+	// the common length must fit the longest PURB, as padded on its own
+	scheme := params.paddingScheme()
+	commonLength := 0
+	for i, data := range messages {
+		purb, err := newPurb(recipientsPerMessage[i], stream, params, options, verbose)
+		if err != nil {
+			return nil, 0, err
+		}
+		purbs = append(purbs, purb)
+		if err := purb.checkPayloadEnd(purb.Header.Length() + len(data)); err != nil {
+			return nil, 0, err
+		}
+
+		purb.encryptData(data)
+		headerLength := purb.Header.Length()
+		length := headerLength + paddedPayloadLength(purb.EncryptedDataLen, headerLength, scheme, purb.macOverlapsWithAllowedPositions) + MAC_AUTHENTICATION_TAG_LENGTH
+		if length > commonLength {
+			commonLength = length
+		}
+	}
+
+	// then grow it, following the scheme, until no MAC overlaps an allowed position of its PURB
+	for {
+		overlaps := false
+		for _, purb := range purbs {
+			if purb.macOverlapsWithAllowedPositions(commonLength-MAC_AUTHENTICATION_TAG_LENGTH, commonLength) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			break
+		}
+		commonLength = scheme.PaddedLength(commonLength + 1)
+	}
+
+	encoded := make([]*EncodedPurb, len(purbs))
+	for i, purb := range purbs {
+		purb.padPayload(commonLength - purb.Header.Length() - MAC_AUTHENTICATION_TAG_LENGTH)
+		if err := purb.placePayloadAndCornerstones(stream); err != nil {
+			return nil, 0, err
+		}
+		purb.addMAC()
+		encoded[i] = purb.toEncodedPurb()
+	}
+	return encoded, commonLength, nil
+}
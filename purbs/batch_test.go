@@ -0,0 +1,72 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestEncodeBatch(t *testing.T) {
+	infoMap := getDummySuiteInfo(3)
+	messages := [][]byte{
+		[]byte("short"),
+		make([]byte, 1000),
+		[]byte("a somewhat longer message, for a few more recipients"),
+	}
+	recipientsPerMessage := [][]Recipient{
+		createRecipients(1, 1, infoMap),
+		createRecipients(2, 3, infoMap),
+		createRecipients(10, 2, infoMap),
+	}
+
+	for _, params := range []*PurbPublicFixedParameters{
+		NewPublicFixedParameters(infoMap, false),
+		{SuiteInfoMap: infoMap, EntrypointsPlacement: PlacementSimplified, PaddingScheme: PowerOfTwoPadding{}},
+	} {
+		purbs, length, err := EncodeBatch(messages, recipientsPerMessage, random.New(), params, nil, false)
+		require.NoError(t, err)
+		require.Len(t, purbs, len(messages))
+		require.Equal(t, params.paddingScheme().PaddedLength(length), length)
+
+		for i, purb := range purbs {
+			require.Len(t, purb.ToBytes(), length)
+			for _, recipient := range recipientsPerMessage[i] {
+				success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+				require.NoError(t, err)
+				require.True(t, success)
+				require.Equal(t, messages[i], message)
+			}
+		}
+	}
+
+	_, _, err := EncodeBatch(messages, recipientsPerMessage[:1], random.New(), NewPublicFixedParameters(infoMap, false), nil, false)
+	require.Error(t, err)
+}
+
+func TestEncodeBatchMACOverlap(t *testing.T) {
+	// without padding, some payload lengths put the MAC on an allowed position of the cornerstone: the common length
+	// must avoid them for every PURB of the batch
+	infoMap := getDummySuiteInfo(4)
+	params := NewPublicFixedParameters(infoMap, true)
+	params.PaddingScheme = NoPadding{}
+	recipients := createRecipients(1, 1, infoMap)
+	info := infoMap[recipients[0].SuiteName]
+	last := info.AllowedPositions[len(info.AllowedPositions)-1]
+
+	for size := 1; size < last; size += 7 {
+		messages := [][]byte{make([]byte, size), []byte("x")}
+		purbs, length, err := EncodeBatch(messages, [][]Recipient{recipients, recipients}, random.New(), params, nil, false)
+		require.NoError(t, err)
+		for _, position := range info.AllowedPositions {
+			require.True(t, length-MAC_AUTHENTICATION_TAG_LENGTH >= position+info.CornerstoneLength || length <= position)
+		}
+		for i, purb := range purbs {
+			require.Len(t, purb.ToBytes(), length)
+			success, message, err := Decode(purb.ToBytes(), &recipients[0], params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, messages[i], message)
+		}
+	}
+}
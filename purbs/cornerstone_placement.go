@@ -0,0 +1,271 @@
+package purbs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Above this number of suites, the exact (exponential in the number of suites) search is replaced by a greedy one
+const MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT = 16
+
+// ErrNoCornerstonePlacement is returned when the AllowedPositions of the suites used leave no valid placement
+var ErrNoCornerstonePlacement = errors.New("could not find a mapping for placing the cornerstones, who designed the AllowedPositions ?!")
+
+// Primary position chosen for one suite's cornerstone
+type cornerstonePlacement struct {
+	suiteName string
+	offset    int
+	endPos    int
+}
+
+// The rules for placing cornerstones are the following:
+// (1) every Suite has *multiple possible positions* for placing a cornerstone;
+// (2) when the PURB is finalized, the decoder XORs *all possible positions* of its suite to get the cornerstone.
+// The encoder writes the cornerstones one after the other, each time setting the primary position to the XOR of the
+// other positions. Hence, when a cornerstone is written, it must not touch any position of a suite written before,
+// otherwise it would break that suite's XOR. Cornerstones are then placed in some order, each primary position avoiding
+// the nonce and *all* the allowed positions of the suites placed before (the so-called "secondary layout").
+//
+// The search works on subsets of suites: a cornerstone can be the last one of a set S iff it has a position avoiding
+// every position of S minus itself, which does not depend on how S minus itself is ordered. For the smallest header,
+// best(S) = min over the possible last cornerstones L of max(end of L, best(S - L)). This is computed for every subset
+// (2^n states for n suites, instead of the n! orderings of a naive search). With more than
+// MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT suites, the last cornerstone is picked greedily instead, which still finds a
+// placement whenever there is one (since "can be last" only gets easier as S shrinks), but not always the shortest.
+//
+// solveCornerstonePlacement returns the placements in the order in which the cornerstones must be written, and the
+// length of the header they occupy (including the nonce).
+func solveCornerstonePlacement(infoMap SuiteInfoMap, suiteNames []string) ([]cornerstonePlacement, int, error) {
+	names := make([]string, len(suiteNames))
+	copy(names, suiteNames)
+	sort.Strings(names)
+
+	suites := make([]*SuiteInfo, len(names))
+	for i, name := range names {
+		suites[i] = infoMap[name]
+		if suites[i] == nil {
+			return nil, 0, fmt.Errorf("no SuiteInfo for suite %v", name)
+		}
+	}
+
+	problem := &placementProblem{suites: suites}
+
+	var order []int
+	var positions []int
+	var err error
+	if len(suites) <= MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT {
+		order, positions, err = problem.solveExact()
+	} else {
+		order, positions, err = problem.solveGreedy()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	placements := make([]cornerstonePlacement, len(order))
+	headerLength := NONCE_LENGTH
+	for i, suiteIndex := range order {
+		start := positions[suiteIndex]
+		end := start + suites[suiteIndex].CornerstoneLength
+		placements[i] = cornerstonePlacement{
+			suiteName: names[suiteIndex],
+			offset:    start,
+			endPos:    end,
+		}
+		if end > headerLength {
+			headerLength = end
+		}
+	}
+	return placements, headerLength, nil
+}
+
+type placementProblem struct {
+	suites []*SuiteInfo
+
+	// conflicts[s][i] is the set (as a bitmask) of suites with an allowed position overlapping the i-th allowed position
+	// of suite s; only computed when building the table
+	conflicts [][]uint64
+}
+
+// computeConflicts fills problem.conflicts, it requires at most 64 suites
+func (p *placementProblem) computeConflicts() {
+	p.conflicts = make([][]uint64, len(p.suites))
+	for s, suite := range p.suites {
+		p.conflicts[s] = make([]uint64, len(suite.AllowedPositions))
+		for i, start := range suite.AllowedPositions {
+			end := start + suite.CornerstoneLength
+			for o, other := range p.suites {
+				if o == s {
+					continue
+				}
+				for _, otherStart := range other.AllowedPositions {
+					if start < otherStart+other.CornerstoneLength && otherStart < end {
+						p.conflicts[s][i] |= 1 << uint(o)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// smallestPosition returns the allowed position of suite s with the smallest end which avoids the nonce and all
+// allowed positions of the suites in "others" (a bitmask), or -1 if there is none
+func (p *placementProblem) smallestPosition(s int, others uint64) int {
+	best := -1
+	for i, start := range p.suites[s].AllowedPositions {
+		if start < NONCE_LENGTH || (best != -1 && start >= best) {
+			continue
+		}
+		if p.conflicts[s][i]&others != 0 {
+			continue
+		}
+		best = start
+	}
+	return best
+}
+
+// placementTable holds, for every subset of suites (as a bitmask), the shortest header length its cornerstones need
+// (or infeasiblePlacement), the suite placed last and its position
+type placementTable struct {
+	best      []int
+	last      []int
+	lastStart []int
+}
+
+const infeasiblePlacement = -1
+
+// table fills the placementTable by dynamic programming over the subsets of suites, smallest subsets first
+func (p *placementProblem) table() *placementTable {
+	n := uint(len(p.suites))
+	full := uint64(1)<<n - 1
+
+	t := &placementTable{
+		best:      make([]int, full+1),
+		last:      make([]int, full+1),
+		lastStart: make([]int, full+1),
+	}
+	best := t.best
+
+	p.computeConflicts()
+	best[0] = NONCE_LENGTH
+	for set := uint64(1); set <= full; set++ {
+		best[set] = infeasiblePlacement
+		for s := uint(0); s < n; s++ {
+			if set&(1<<s) == 0 {
+				continue
+			}
+			rest := set &^ (1 << s)
+			if best[rest] == infeasiblePlacement {
+				continue
+			}
+			start := p.smallestPosition(int(s), rest)
+			if start == -1 {
+				continue
+			}
+			length := start + p.suites[s].CornerstoneLength
+			if best[rest] > length {
+				length = best[rest]
+			}
+			if best[set] == infeasiblePlacement || length < best[set] {
+				best[set] = length
+				t.last[set] = int(s)
+				t.lastStart[set] = start
+			}
+		}
+	}
+	return t
+}
+
+// solveExact computes the shortest placement of all the suites
+func (p *placementProblem) solveExact() ([]int, []int, error) {
+	n := uint(len(p.suites))
+	full := uint64(1)<<n - 1
+
+	t := p.table()
+	best, last, lastStart := t.best, t.last, t.lastStart
+
+	if best[full] == infeasiblePlacement {
+		return nil, nil, ErrNoCornerstonePlacement
+	}
+
+	// walk back from the full set to recover the order
+	order := make([]int, n)
+	positions := make([]int, n)
+	set := full
+	for i := int(n) - 1; i >= 0; i-- {
+		order[i] = last[set]
+		positions[last[set]] = lastStart[set]
+		set &^= 1 << uint(last[set])
+	}
+	return order, positions, nil
+}
+
+// solveGreedy repeatedly picks, as the last cornerstone of the remaining suites, the one whose position ends first
+func (p *placementProblem) solveGreedy() ([]int, []int, error) {
+	n := len(p.suites)
+	order := make([]int, n)
+	positions := make([]int, n)
+
+	remaining := make(map[int]bool)
+	for s := 0; s < n; s++ {
+		remaining[s] = true
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		chosen, chosenStart, chosenEnd := -1, -1, -1
+		for s := 0; s < n; s++ {
+			if !remaining[s] {
+				continue
+			}
+			start := p.smallestPositionAmong(s, remaining)
+			if start == -1 {
+				continue
+			}
+			end := start + p.suites[s].CornerstoneLength
+			if chosen == -1 || end < chosenEnd {
+				chosen, chosenStart, chosenEnd = s, start, end
+			}
+		}
+		if chosen == -1 {
+			return nil, nil, ErrNoCornerstonePlacement
+		}
+		order[i] = chosen
+		positions[chosen] = chosenStart
+		delete(remaining, chosen)
+	}
+	return order, positions, nil
+}
+
+// same as smallestPosition, for when there are too many suites for a bitmask
+func (p *placementProblem) smallestPositionAmong(s int, remaining map[int]bool) int {
+	suite := p.suites[s]
+	best := -1
+	for _, start := range suite.AllowedPositions {
+		end := start + suite.CornerstoneLength
+		if start < NONCE_LENGTH || (best != -1 && start >= best) {
+			continue
+		}
+		collides := false
+		for o := range remaining {
+			if o == s {
+				continue
+			}
+			other := p.suites[o]
+			for _, otherStart := range other.AllowedPositions {
+				if start < otherStart+other.CornerstoneLength && otherStart < end {
+					collides = true
+					break
+				}
+			}
+			if collides {
+				break
+			}
+		}
+		if !collides {
+			best = start
+		}
+	}
+	return best
+}
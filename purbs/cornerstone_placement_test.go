@@ -0,0 +1,183 @@
+package purbs
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// checks that each cornerstone avoids the nonce and every allowed position of the cornerstones placed before it
+func requireValidPlacement(t *testing.T, infoMap SuiteInfoMap, placements []cornerstonePlacement) {
+	for i, placement := range placements {
+		require.True(t, placement.offset >= NONCE_LENGTH)
+		for _, before := range placements[:i] {
+			info := infoMap[before.suiteName]
+			for _, pos := range info.AllowedPositions {
+				require.False(t, placement.offset < pos+info.CornerstoneLength && pos < placement.endPos,
+					"%v at %v overlaps %v at %v", placement.suiteName, placement.offset, before.suiteName, pos)
+			}
+		}
+	}
+}
+
+// the naive search: tries every ordering, returns the shortest header length, or -1
+func bruteForcePlacement(infoMap SuiteInfoMap, names []string) int {
+	best := -1
+	var permute func(placed []string, remaining []string)
+	permute = func(placed []string, remaining []string) {
+		if len(remaining) == 0 {
+			length := NONCE_LENGTH
+			for i, name := range placed {
+				info := infoMap[name]
+				end := -1
+				for _, pos := range info.AllowedPositions {
+					if pos < NONCE_LENGTH {
+						continue
+					}
+					free := true
+					for _, before := range placed[:i] {
+						beforeInfo := infoMap[before]
+						for _, beforePos := range beforeInfo.AllowedPositions {
+							if pos < beforePos+beforeInfo.CornerstoneLength && beforePos < pos+info.CornerstoneLength {
+								free = false
+							}
+						}
+					}
+					if free && (end == -1 || pos+info.CornerstoneLength < end) {
+						end = pos + info.CornerstoneLength
+					}
+				}
+				if end == -1 {
+					return
+				}
+				if end > length {
+					length = end
+				}
+			}
+			if best == -1 || length < best {
+				best = length
+			}
+			return
+		}
+		for i := range remaining {
+			rest := append(append([]string{}, remaining[:i]...), remaining[i+1:]...)
+			permute(append(placed, remaining[i]), rest)
+		}
+	}
+	permute(nil, names)
+	return best
+}
+
+func randomSuiteInfoMap(rng *rand.Rand, nSuites int) (SuiteInfoMap, []string) {
+	infoMap := make(SuiteInfoMap)
+	names := make([]string, 0)
+	for i := 0; i < nSuites; i++ {
+		name := "suite" + strconv.Itoa(i)
+		cornerstoneLength := 16 * (1 + rng.Intn(3))
+		positions := make([]int, 0)
+		pos := rng.Intn(2) * NONCE_LENGTH
+		for j := 0; j < 1+rng.Intn(4); j++ {
+			positions = append(positions, pos)
+			pos += 16 * (1 + rng.Intn(4))
+		}
+		infoMap[name] = &SuiteInfo{
+			AllowedPositions:  positions,
+			CornerstoneLength: cornerstoneLength,
+			EntryPointLength:  ENTRYPOINT_LENGTH,
+		}
+		names = append(names, name)
+	}
+	return infoMap, names
+}
+
+func TestCornerstonePlacementIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	feasible := 0
+	for k := 0; k < 300; k++ {
+		infoMap, names := randomSuiteInfoMap(rng, 1+rng.Intn(5))
+
+		expected := bruteForcePlacement(infoMap, names)
+		placements, length, err := solveCornerstonePlacement(infoMap, names)
+		if expected == -1 {
+			require.Equal(t, ErrNoCornerstonePlacement, err)
+			continue
+		}
+		feasible++
+		require.NoError(t, err)
+		require.Equal(t, expected, length)
+		require.Len(t, placements, len(names))
+		requireValidPlacement(t, infoMap, placements)
+	}
+	require.True(t, feasible > 0)
+}
+
+func TestCornerstonePlacementManySuites(t *testing.T) {
+	// too many suites for the exact search: every suite gets its own disjoint positions, so any order works
+	infoMap := make(SuiteInfoMap)
+	names := make([]string, 0)
+	for i := 0; i < MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT+4; i++ {
+		name := "suite" + strconv.Itoa(i)
+		infoMap[name] = &SuiteInfo{
+			AllowedPositions:  []int{NONCE_LENGTH + 32*i},
+			CornerstoneLength: 32,
+			EntryPointLength:  ENTRYPOINT_LENGTH,
+		}
+		names = append(names, name)
+	}
+
+	placements, length, err := solveCornerstonePlacement(infoMap, names)
+	require.NoError(t, err)
+	require.Len(t, placements, len(names))
+	require.Equal(t, NONCE_LENGTH+32*len(names), length)
+	requireValidPlacement(t, infoMap, placements)
+}
+
+func TestCornerstonePlacementFailure(t *testing.T) {
+	// both suites can only use the same bytes
+	infoMap := getDummySuiteInfo(2)
+	for _, info := range infoMap {
+		info.AllowedPositions = []int{NONCE_LENGTH}
+	}
+	params := NewPublicFixedParameters(infoMap, false)
+	recipients := createRecipients(1, 2, infoMap)
+
+	_, err := Encode([]byte("SomeInfo"), recipients, random.New(), params, false)
+	require.Equal(t, ErrNoCornerstonePlacement, err)
+}
+
+func TestCornerstonePlacementOrder(t *testing.T) {
+	// the first suite can only sit on the second slot, which is also a (secondary) position of the other suite:
+	// it must be written first, although the other cornerstone comes before it in the header
+	infoMap := getDummySuiteInfo(2)
+	names := make([]string, 0)
+	for name := range infoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infoMap[names[0]].AllowedPositions = []int{NONCE_LENGTH + 32}
+	infoMap[names[1]].AllowedPositions = []int{NONCE_LENGTH, NONCE_LENGTH + 32}
+
+	placements, length, err := solveCornerstonePlacement(infoMap, names)
+	require.NoError(t, err)
+	require.Equal(t, NONCE_LENGTH+64, length)
+	require.Equal(t, names[0], placements[0].suiteName)
+	require.Equal(t, names[1], placements[1].suiteName)
+	require.Equal(t, NONCE_LENGTH, placements[1].offset)
+
+	// the XOR trick only works out if the cornerstones are written in that order
+	data := []byte("SomeInfo")
+	params := NewPublicFixedParameters(infoMap, false)
+	recipients := createRecipients(1, 2, infoMap)
+	purb, err := Encode(data, recipients, random.New(), params, false)
+	require.NoError(t, err)
+	for _, recipient := range recipients {
+		success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+}
@@ -0,0 +1,80 @@
+package purbs
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// What the real PURBs look like, for GenerateCover to imitate. Each list is sampled uniformly, so repeating a value
+// makes it more likely
+type CoverDistribution struct {
+	PlaintextLengths []int            // lengths of the plaintexts
+	RecipientCounts  []int            // numbers of recipients
+	Suites           map[string]Suite // suiteName -> suite, the suite of each recipient is picked uniformly among them
+}
+
+// GenerateCover returns random bytes with the length of a real PURB: it samples a plaintext length and a number of
+// recipients, builds a real header for throwaway recipients (so that the placement randomness, the header padding and
+// the suites are the same as for real PURBs), then pads the payload and moves the MAC like Encode does
+func GenerateCover(params *PurbPublicFixedParameters, distribution *CoverDistribution, stream cipher.Stream) ([]byte, error) {
+	length, err := coverLength(params, distribution, stream)
+	if err != nil {
+		return nil, err
+	}
+	cover := make([]byte, length)
+	random.Bytes(cover, stream)
+	return cover, nil
+}
+
+// coverLength samples the length of a PURB from the distribution
+func coverLength(params *PurbPublicFixedParameters, distribution *CoverDistribution, stream cipher.Stream) (int, error) {
+	if len(distribution.PlaintextLengths) == 0 || len(distribution.RecipientCounts) == 0 || len(distribution.Suites) == 0 {
+		return 0, errors.New("the cover distribution needs plaintext lengths, recipient counts and suites")
+	}
+	suiteNames := make([]string, 0, len(distribution.Suites))
+	for suiteName := range distribution.Suites {
+		suiteNames = append(suiteNames, suiteName)
+	}
+	sort.Strings(suiteNames)
+
+	plaintextLength := distribution.PlaintextLengths[randomIndex(stream, len(distribution.PlaintextLengths))]
+	nRecipients := distribution.RecipientCounts[randomIndex(stream, len(distribution.RecipientCounts))]
+	if plaintextLength < 0 || nRecipients < 1 {
+		return 0, errors.New("invalid plaintext length or number of recipients in the cover distribution")
+	}
+
+	recipients := make([]Recipient, nRecipients)
+	for i := range recipients {
+		suiteName := suiteNames[randomIndex(stream, len(suiteNames))]
+		suite := distribution.Suites[suiteName]
+		pair := key.NewKeyPair(suite)
+		recipients[i] = Recipient{SuiteName: suiteName, Suite: suite, PublicKey: pair.Public}
+	}
+
+	purb, err := newPurb(recipients, stream, params, nil, false)
+	if err != nil {
+		return 0, err
+	}
+	defer purb.wipeSecrets()
+	headerLength := purb.Header.Length()
+	if err := purb.checkPayloadEnd(headerLength + plaintextLength); err != nil {
+		return 0, err
+	}
+
+	// the payload is encrypted with a stream cipher, so it is as long as the plaintext
+	payloadLength := paddedPayloadLength(plaintextLength, headerLength, params.paddingScheme(), purb.macOverlapsWithAllowedPositions)
+	return headerLength + payloadLength + MAC_AUTHENTICATION_TAG_LENGTH, nil
+}
+
+// randomIndex returns a uniform index in [0, n[
+func randomIndex(stream cipher.Stream, n int) int {
+	b := make([]byte, 8)
+	random.Bytes(b, stream)
+	// the modulo bias is below n/2^64
+	return int(binary.BigEndian.Uint64(b) % uint64(n))
+}
@@ -0,0 +1,58 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/group/curve25519"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestGenerateCover(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(1, 1, infoMap)
+	suiteName := recipients[0].SuiteName
+	params := NewPublicFixedParameters(infoMap, true)
+
+	// with one recipient and the simplified placement, the header is always the same, so the cover must have exactly
+	// the length of a real PURB, MAC adjustments included
+	for plaintextLength := 0; plaintextLength < 300; plaintextLength += 11 {
+		distribution := &CoverDistribution{
+			PlaintextLengths: []int{plaintextLength},
+			RecipientCounts:  []int{1},
+			Suites:           map[string]Suite{suiteName: curve25519.NewBlakeSHA256Curve25519(true)},
+		}
+		cover, err := GenerateCover(params, distribution, random.New())
+		require.NoError(t, err)
+
+		purb, err := Encode(make([]byte, plaintextLength), recipients, random.New(), params, false)
+		require.NoError(t, err)
+		require.Len(t, cover, len(purb.ToBytes()))
+	}
+}
+
+func TestGenerateCoverSampling(t *testing.T) {
+	infoMap := getDummySuiteInfo(2)
+	suites := make(map[string]Suite)
+	for suiteName := range infoMap {
+		suites[suiteName] = curve25519.NewBlakeSHA256Curve25519(true)
+	}
+	params := NewPublicFixedParameters(infoMap, false)
+	distribution := &CoverDistribution{
+		PlaintextLengths: []int{10, 10000},
+		RecipientCounts:  []int{1, 5},
+		Suites:           suites,
+	}
+
+	lengths := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		cover, err := GenerateCover(params, distribution, random.New())
+		require.NoError(t, err)
+		require.Equal(t, params.paddingScheme().PaddedLength(len(cover)), len(cover))
+		lengths[len(cover)] = true
+	}
+	require.True(t, len(lengths) > 1)
+
+	_, err := GenerateCover(params, &CoverDistribution{Suites: suites}, random.New())
+	require.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package purbs
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// Number of buckets an entrypoint can go to in a cuckoo table
+const CUCKOO_CHOICES = 2
+
+// Number of entrypoint slots in a bucket of a cuckoo table
+const CUCKOO_BUCKET_SIZE = 2
+
+// Cuckoo tables are sized so that, with CuckooMaxEntrypoints entrypoints, at most this fraction of the slots is used.
+// Two choices of buckets of two slots work up to a load of ~0.89, but other suites' cornerstones and tables take slots too,
+// and even more when their entrypoint lengths differ, as their slots are then not aligned
+const CUCKOO_MAX_LOAD = 0.7
+
+// Number of headers, each with fresh cornerstones, CreateHeader tries before giving up on a cuckoo placement
+const MAX_CUCKOO_HEADER_ATTEMPTS = 8
+
+// ErrTooManyEntrypoints is returned when a PURB has more recipients than CuckooMaxEntrypoints
+var ErrTooManyEntrypoints = errors.New("more entrypoints than CuckooMaxEntrypoints")
+
+// ErrCuckooPlacement is returned when the entrypoints do not fit in the cuckoo tables
+var ErrCuckooPlacement = errors.New("could not place the entrypoints in the cuckoo tables")
+
+// Number of buckets of the cuckoo table of each suite
+func cuckooBuckets(maxEntrypoints int) int {
+	slots := int(float64(maxEntrypoints)/CUCKOO_MAX_LOAD + 0.999999)
+	buckets := (slots + CUCKOO_BUCKET_SIZE - 1) / CUCKOO_BUCKET_SIZE
+	if buckets < 1 {
+		buckets = 1
+	}
+	return buckets
+}
+
+// cuckooCandidates returns the start positions of the slots where an entrypoint can be: the slots of its
+// CUCKOO_CHOICES buckets (or fewer if the table is smaller), derived from the shared secret. The same positions are
+// probed by the decoder
+func cuckooCandidates(sharedSecret []byte, suiteInfo *SuiteInfo, maxEntrypoints int) []int {
+	tableStartPos := suiteInfo.AllowedPositions[0] + suiteInfo.CornerstoneLength
+	buckets := cuckooBuckets(maxEntrypoints)
+
+	candidates := make([]int, 0, CUCKOO_CHOICES*CUCKOO_BUCKET_SIZE)
+	previousBucket := -1
+	for choice := 0; choice < CUCKOO_CHOICES; choice++ {
+		purpose := "pos"
+		if choice > 0 {
+			purpose += strconv.Itoa(choice + 1)
+		}
+		bucket := int(binary.BigEndian.Uint32(KDF(purpose, sharedSecret)) % uint32(buckets))
+
+		// two choices falling in the same bucket would waste one; take the next bucket instead
+		if bucket == previousBucket {
+			if buckets == 1 {
+				break
+			}
+			bucket = (bucket + 1) % buckets
+		}
+		previousBucket = bucket
+
+		for slot := 0; slot < CUCKOO_BUCKET_SIZE; slot++ {
+			candidates = append(candidates, tableStartPos+(bucket*CUCKOO_BUCKET_SIZE+slot)*suiteInfo.EntryPointLength)
+		}
+	}
+	return candidates
+}
+
+// placeEntrypointsCuckoo places all entrypoints by cuckoo hashing. Tables of different suites can overlap, hence all
+// entrypoints are inserted together: an entrypoint which does not find a free candidate slot moves another one to one
+// of its own candidates, and so on. The moves are searched breadth-first, so an entrypoint is only rejected if no such
+// chain of moves exists. The header ends at the last used slot, the rest of the table is never written
+func (purb *Purb) placeEntrypointsCuckoo() error {
+	maxEntrypoints := purb.PublicParameters.CuckooMaxEntrypoints
+
+	entrypoints := make([]*EntryPoint, 0)
+	for _, suite := range purb.Header.suiteNames() {
+		entrypoints = append(entrypoints, purb.Header.EntryPoints[suite]...)
+	}
+	if len(entrypoints) > maxEntrypoints {
+		return ErrTooManyEntrypoints
+	}
+
+	candidates := make([][]int, len(entrypoints))
+	for i, entrypoint := range entrypoints {
+		suiteInfo := purb.PublicParameters.SuiteInfoMap[entrypoint.Recipient.SuiteName]
+		candidates[i] = cuckooCandidates(entrypoint.sharedSecret, suiteInfo, maxEntrypoints)
+	}
+
+	table := newCuckooTable(purb.Header.Layout, entrypoints, candidates)
+	for i := range entrypoints {
+		if !table.insert(i) {
+			return ErrCuckooPlacement
+		}
+	}
+
+	for i, entrypoint := range entrypoints {
+		entrypoint.Offset = table.positions[i]
+		if !purb.Header.Layout.Reserve(entrypoint.Offset, entrypoint.Offset+entrypoint.Length, true, "cuckoo"+strconv.Itoa(i)) {
+			return ErrCuckooPlacement
+		}
+		if purb.IsVerbose {
+			log.LLvlf3("Found position for entrypoint of suite %v, CUCKOO, start %v, end %v", entrypoint.Recipient.SuiteName, entrypoint.Offset, entrypoint.Offset+entrypoint.Length)
+		}
+	}
+	return nil
+}
+
+type cuckooTable struct {
+	layout      *RegionReservationStruct // what is already placed (nonce, cornerstones), entrypoints are not reserved yet
+	entrypoints []*EntryPoint
+	candidates  [][]int     // entrypoint -> candidate slots
+	positions   []int       // entrypoint -> current slot, or -1
+	occupied    map[int]int // slot -> entrypoint placed there
+	maxLength   int         // of the entrypoints
+}
+
+func newCuckooTable(layout *RegionReservationStruct, entrypoints []*EntryPoint, candidates [][]int) *cuckooTable {
+	t := &cuckooTable{
+		layout:      layout,
+		entrypoints: entrypoints,
+		candidates:  candidates,
+		positions:   make([]int, len(entrypoints)),
+		occupied:    make(map[int]int),
+	}
+	for i, entrypoint := range entrypoints {
+		t.positions[i] = -1
+		if entrypoint.Length > t.maxLength {
+			t.maxLength = entrypoint.Length
+		}
+	}
+	return t
+}
+
+func (t *cuckooTable) setPosition(entrypoint, slot int) {
+	if old := t.positions[entrypoint]; old != -1 && t.occupied[old] == entrypoint {
+		delete(t.occupied, old)
+	}
+	t.positions[entrypoint] = slot
+	t.occupied[slot] = entrypoint
+}
+
+// occupants returns the placed entrypoints (other than "moving") overlapping [start, end[
+func (t *cuckooTable) occupants(start, end, moving int) []int {
+	res := make([]int, 0)
+	for pos := start - t.maxLength + 1; pos < end; pos++ {
+		i, found := t.occupied[pos]
+		if !found || i == moving {
+			continue
+		}
+		if start < pos+t.entrypoints[i].Length {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// insert places entrypoint "inserted", moving other entrypoints if needed, and returns false if it is impossible
+func (t *cuckooTable) insert(inserted int) bool {
+	type move struct {
+		entrypoint int
+		slot       int
+		parent     int // index in "moves" of the move which evicted this entrypoint, -1 for the inserted one
+	}
+
+	visited := map[int]bool{inserted: true}
+	queue := []move{{entrypoint: inserted, slot: -1, parent: -1}}
+	for head := 0; head < len(queue); head++ {
+		current := queue[head]
+		length := t.entrypoints[current.entrypoint].Length
+
+		for _, slot := range t.candidates[current.entrypoint] {
+			if slot == t.positions[current.entrypoint] || !t.layout.IsFree(slot, slot+length) {
+				continue
+			}
+			occupants := t.occupants(slot, slot+length, current.entrypoint)
+
+			if len(occupants) == 0 {
+				// free slot: apply the chain of moves, from the last one
+				t.setPosition(current.entrypoint, slot)
+				for m := current; m.parent != -1; {
+					parent := queue[m.parent]
+					t.setPosition(parent.entrypoint, m.slot)
+					m = parent
+				}
+				return true
+			}
+
+			// only follow simple evictions (one entrypoint in the way), which is the case when the slots are aligned
+			if len(occupants) == 1 && !visited[occupants[0]] {
+				visited[occupants[0]] = true
+				queue = append(queue, move{entrypoint: occupants[0], slot: slot, parent: head})
+			}
+		}
+	}
+	return false
+}
+
+func entrypointTrialDecodeCuckoo(blob []byte, recipient *Recipient, sharedSecret []byte, suiteInfo *SuiteInfo, maxEntrypoints int, verbose bool) (bool, *decodedPurb, error) {
+	if maxEntrypoints < 1 {
+		return false, nil, ErrTooManyEntrypoints
+	}
+
+	entrypointKey := KDF("key", sharedSecret)
+	defer zeroBytes(entrypointKey)
+	nonce := blob[:NONCE_LENGTH]
+	data := blob[:len(blob)-MAC_AUTHENTICATION_TAG_LENGTH]
+
+	for _, startPos := range cuckooCandidates(sharedSecret, suiteInfo, maxEntrypoints) {
+		endPos := startPos + suiteInfo.EntryPointLength
+		if endPos > len(data) {
+			continue
+		}
+
+		decrypted, err := aeadDecrypt(data[startPos:endPos], nonce, entrypointKey, nil)
+		if err != nil {
+			continue // it is not the correct entry point so we move one to try again
+		}
+
+		if verbose {
+			log.LLvlf3("Recovering potential entrypoint [%v:%v], value %v", startPos, endPos, data[startPos:endPos])
+		}
+
+		found, decoded, err := openEntrypoint(decrypted, blob, verbose)
+		if err != nil || found {
+			return found, decoded, err
+		}
+	}
+	return false, nil, errors.New("no entrypoint was correctly decrypted")
+}
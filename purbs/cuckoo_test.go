@@ -0,0 +1,71 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestCuckooPlacement(t *testing.T) {
+	data := []byte("SomeInfo")
+	for _, setup := range []struct{ nRecipients, nSuites int }{{1, 1}, {40, 1}, {10, 3}} {
+		infoMap := getDummySuiteInfo(setup.nSuites)
+		recipients := createRecipients(setup.nRecipients, setup.nSuites, infoMap)
+		params := NewCuckooPublicFixedParameters(infoMap, len(recipients))
+		require.True(t, params.Validate().OK())
+
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		require.Len(t, purb.EntryPoints, len(recipients))
+
+		// the header never goes beyond the tables
+		for _, info := range infoMap {
+			tableEnd := info.AllowedPositions[0] + info.CornerstoneLength +
+				cuckooBuckets(len(recipients))*CUCKOO_BUCKET_SIZE*info.EntryPointLength
+			require.True(t, purb.HeaderLength <= tableEnd)
+		}
+
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
+
+func TestCuckooCandidates(t *testing.T) {
+	info := getDummySuiteInfo(1)
+	for _, suiteInfo := range info {
+		tableStart := suiteInfo.AllowedPositions[0] + suiteInfo.CornerstoneLength
+		for _, maxEntrypoints := range []int{1, 2, 100} {
+			tableEnd := tableStart + cuckooBuckets(maxEntrypoints)*CUCKOO_BUCKET_SIZE*suiteInfo.EntryPointLength
+			for i := 0; i < 20; i++ {
+				secret := make([]byte, 32)
+				random.Bytes(secret, random.New())
+
+				// decoders have a fixed number of slots to try, all inside the table
+				candidates := cuckooCandidates(secret, suiteInfo, maxEntrypoints)
+				require.True(t, len(candidates) <= CUCKOO_CHOICES*CUCKOO_BUCKET_SIZE)
+				for _, candidate := range candidates {
+					require.True(t, candidate >= tableStart)
+					require.True(t, candidate+suiteInfo.EntryPointLength <= tableEnd)
+					require.Equal(t, 0, (candidate-tableStart)%suiteInfo.EntryPointLength)
+				}
+			}
+		}
+	}
+}
+
+func TestCuckooTooManyEntrypoints(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(5, 1, infoMap)
+	params := NewCuckooPublicFixedParameters(infoMap, 4)
+
+	_, err := Encode([]byte("SomeInfo"), recipients, random.New(), params, false)
+	require.Equal(t, ErrTooManyEntrypoints, err)
+
+	params.CuckooMaxEntrypoints = 0
+	require.Len(t, issuesOfKind(params.Validate(), IssueCuckooBound), 1)
+}
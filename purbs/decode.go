@@ -5,13 +5,54 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
 
 	kyber "gopkg.in/dedis/kyber.v2"
 	log "gopkg.in/dedis/onet.v2/log"
 )
 
-// Decode takes a PURB blob and a recipient info (suite+KeyPair) and extracts the payload
+// Returned when decoding an input too short to hold the nonce and the MAC of a PURB
+var ErrBlobTooShort = errors.New("too short to be a PURB")
+
+// What a recipient learns from a PURB: its format, and the data
+type decodedPurb struct {
+	version byte
+	flags   byte
+	data    []byte
+}
+
+// Decode takes a PURB blob, raw or armored (see ArmorEncode), and a recipient info (suite+KeyPair) and extracts the payload.
+// The metadata of a PURB created by EncodeWithMetadata is dropped, see DecodeWithMetadata
 func Decode(blob []byte, recipient *Recipient, publicFixedParameters *PurbPublicFixedParameters, verbose bool) (bool, []byte, error) {
+	found, decoded, err := decode(blob, recipient, publicFixedParameters, verbose)
+	if err != nil || !found {
+		return found, nil, err
+	}
+	found, _, data, err := decoded.unwrapMetadata()
+	return found, data, err
+}
+
+// decode is Decode, returning the format of the PURB along with its data. An input which reads as armor in several
+// encodings is decoded in each of them, until one has a valid PURB; otherwise, the result is that of the first one
+func decode(input []byte, recipient *Recipient, publicFixedParameters *PurbPublicFixedParameters, verbose bool) (bool, *decodedPurb, error) {
+	candidates := unarmorCandidates(input)
+	found, decoded, err := decodeBlob(candidates[0], recipient, publicFixedParameters, verbose)
+	for _, blob := range candidates[1:] {
+		if found {
+			break
+		}
+		if otherFound, otherDecoded, otherErr := decodeBlob(blob, recipient, publicFixedParameters, verbose); otherFound {
+			found, decoded, err = otherFound, otherDecoded, otherErr
+		}
+	}
+	return found, decoded, err
+}
+
+// decodeBlob decodes a raw PURB
+func decodeBlob(blob []byte, recipient *Recipient, publicFixedParameters *PurbPublicFixedParameters, verbose bool) (bool, *decodedPurb, error) {
+	if len(blob) < NONCE_LENGTH+MAC_AUTHENTICATION_TAG_LENGTH {
+		return false, nil, ErrBlobTooShort
+	}
 	suiteName := recipient.SuiteName
 	suiteInfo := publicFixedParameters.SuiteInfoMap[suiteName]
 
@@ -68,20 +109,31 @@ func Decode(blob []byte, recipient *Recipient, publicFixedParameters *PurbPublic
 		log.LLvlf3("Recovered sharedsecret value %v, len %v", sharedSecret, len(sharedSecret))
 	}
 
+	// only the derived secret is needed from now on, which itself is wiped once the trial decoding is over
+	zeroBytes(sharedBytes)
+	sharedKey.Null()
+	defer zeroBytes(sharedSecret)
+
 	// Now we try to decrypt iteratively the entrypoints and check if the decrypted SessionKey works for AEAD of payload
-	if !publicFixedParameters.SimplifiedEntrypointsPlacement {
+	switch publicFixedParameters.EntrypointsPlacement {
+	case PlacementHashTable:
 		return entrypointTrialDecode(blob, recipient, sharedSecret, suiteInfo, publicFixedParameters.HashTableCollisionLinearResolutionAttempts, verbose)
+	case PlacementSimplified:
+		return entrypointTrialDecodeSimplified(blob, recipient, sharedSecret, suiteInfo, verbose)
+	case PlacementCuckoo:
+		return entrypointTrialDecodeCuckoo(blob, recipient, sharedSecret, suiteInfo, publicFixedParameters.CuckooMaxEntrypoints, verbose)
 	}
-	return entrypointTrialDecodeSimplified(blob, recipient, sharedSecret, suiteInfo, verbose)
+	return false, nil, fmt.Errorf("unknown entrypoints placement mode %v", publicFixedParameters.EntrypointsPlacement)
 }
 
-func entrypointTrialDecode(blob []byte, recipient *Recipient, sharedSecret []byte, suiteInfo *SuiteInfo, hashTableLinearResolutionCollisionAttempt int, verbose bool) (bool, []byte, error) {
+func entrypointTrialDecode(blob []byte, recipient *Recipient, sharedSecret []byte, suiteInfo *SuiteInfo, hashTableLinearResolutionCollisionAttempt int, verbose bool) (bool, *decodedPurb, error) {
 
 	intOfHashedValue := int(binary.BigEndian.Uint32(KDF("pos", sharedSecret))) // Large number to become a position
 	tableSize := 1
 	hashTableStartPos := suiteInfo.AllowedPositions[0] + suiteInfo.CornerstoneLength
 
 	entrypointKey := KDF("key", sharedSecret)
+	defer zeroBytes(entrypointKey)
 	nonce := blob[:NONCE_LENGTH]
 	data := blob[:len(blob)-MAC_AUTHENTICATION_TAG_LENGTH]
 	for {
@@ -95,8 +147,8 @@ func entrypointTrialDecode(blob []byte, recipient *Recipient, sharedSecret []byt
 			entrypointEndPos := hashTableStartPos + (entrypointIndexInHashTable+1)*suiteInfo.EntryPointLength
 
 			if entrypointEndPos > len(data) {
-				// we're outside the hash table (even outside the blob!), so this j isn't valid
-				break
+				// we're outside the blob, so this j isn't valid (but the next one might wrap around the table)
+				continue
 			}
 
 			decrypted, err := aeadDecrypt(data[entrypointStartPos:entrypointEndPos], nonce, entrypointKey, nil)
@@ -110,37 +162,27 @@ func entrypointTrialDecode(blob []byte, recipient *Recipient, sharedSecret []byt
 				log.LLvlf3("  yield %v", decrypted)
 			}
 
-			ok := verifyMAC(decrypted, blob)
-			if !ok {
-				return false, nil, errors.New("authentication tag is invalid")
-			}
-
-			found, errorReason, message := payloadDecrypt(decrypted, data)
-
-			if verbose {
-				log.LLvlf3("  found=%v, reason=%v, decrypted=%v", found, errorReason, message)
-			}
-
-			if found {
-				return found, message, nil
+			found, decoded, err := openEntrypoint(decrypted, blob, verbose)
+			if err != nil || found {
+				return found, decoded, err
 			}
 		}
 
 		hashTableStartPos += tableSize * suiteInfo.EntryPointLength
-		entrypointEndPos := hashTableStartPos + (entrypointIndexInHashTable+1)*suiteInfo.EntryPointLength
 		tableSize *= 2
 
-		if entrypointEndPos > len(data) {
-			// we're outside the hash table (even outside the blob!), so we should have decoded the entrypoint before
+		if hashTableStartPos+suiteInfo.EntryPointLength > len(data) {
+			// not even the first entry of the next hash table fits in the blob, so we should have decoded the entrypoint before
 			return false, nil, errors.New("no entrypoint was correctly decrypted")
 		}
 	}
 }
 
-func entrypointTrialDecodeSimplified(blob []byte, recipient *Recipient, sharedSecret []byte, suiteInfo *SuiteInfo, verbose bool) (bool, []byte, error) {
+func entrypointTrialDecodeSimplified(blob []byte, recipient *Recipient, sharedSecret []byte, suiteInfo *SuiteInfo, verbose bool) (bool, *decodedPurb, error) {
 	startPos := suiteInfo.AllowedPositions[0] + suiteInfo.CornerstoneLength
 
 	entrypointKey := KDF("key", sharedSecret)
+	defer zeroBytes(entrypointKey)
 	nonce := blob[:NONCE_LENGTH]
 	data := blob[:len(blob)-MAC_AUTHENTICATION_TAG_LENGTH]
 	for startPos+suiteInfo.EntryPointLength < len(data) {
@@ -151,28 +193,45 @@ func entrypointTrialDecodeSimplified(blob []byte, recipient *Recipient, sharedSe
 			continue // it is not the correct entry point so we move one to try again
 		}
 
-		ok := verifyMAC(decrypted, blob)
-		if !ok {
-			return false, nil, errors.New("authentication tag is invalid")
+		found, decoded, err := openEntrypoint(decrypted, blob, verbose)
+		if err != nil || found {
+			return found, decoded, err
 		}
+		startPos += suiteInfo.EntryPointLength
+	}
 
-		found, errorReason, message := payloadDecrypt(decrypted, data)
+	return false, nil, errors.New("no entrypoint was correctly decrypted")
+}
 
-		if verbose {
-			log.LLvlf3("  found=%v, reason=%v, decrypted=%v", found, errorReason, message)
-		}
-		if found {
-			return found, message, nil
-		}
+// openEntrypoint parses a decrypted entrypoint, then checks the MAC and decrypts the payload as its format version
+// says. It returns found=false and no error if the pointers are invalid; the trial decoders then go on with the next
+// candidate entrypoint
+func openEntrypoint(decrypted []byte, blob []byte, verbose bool) (bool, *decodedPurb, error) {
+	defer zeroBytes(decrypted)
+	fields, err := parseEntrypointContent(decrypted)
+	if err != nil {
+		return false, nil, err
 	}
+	version := formatVersions[fields.version]
 
-	return false, nil, errors.New("no entrypoint was correctly decrypted")
+	if !verifyMAC(fields.sessionKey, version, blob) {
+		return false, nil, errors.New("authentication tag is invalid")
+	}
+
+	found, errorReason, message := payloadDecrypt(fields, version, blob[:len(blob)-MAC_AUTHENTICATION_TAG_LENGTH])
+
+	if verbose {
+		log.LLvlf3("  version=%v, flags=%v, found=%v, reason=%v, decrypted=%v", fields.version, fields.flags, found, errorReason, message)
+	}
+	if !found {
+		return false, nil, nil
+	}
+	return true, &decodedPurb{version: fields.version, flags: fields.flags, data: message}, nil
 }
 
 // verifies the authentication tag of a PURB
-func verifyMAC(entrypoint []byte, blob []byte) bool {
-	sessionKey := entrypoint[0:SYMMETRIC_KEY_LENGTH]
-	macKey := KDF("mac", sessionKey)
+func verifyMAC(sessionKey []byte, version *formatVersion, blob []byte) bool {
+	macKey := KDF(version.macLabel, sessionKey)
 
 	data := blob[:len(blob)-MAC_AUTHENTICATION_TAG_LENGTH]
 	tag := blob[len(blob)-MAC_AUTHENTICATION_TAG_LENGTH:]
@@ -180,28 +239,23 @@ func verifyMAC(entrypoint []byte, blob []byte) bool {
 	mac := hmac.New(sha256.New, macKey)
 	mac.Write(data)
 	computedMAC := mac.Sum(nil)
+	zeroBytes(macKey)
 	return hmac.Equal(computedMAC, tag)
 }
 
-func payloadDecrypt(entrypoint []byte, fullPURBBlob []byte) (bool, string, []byte) {
+func payloadDecrypt(fields *entrypointFields, version *formatVersion, fullPURBBlob []byte) (bool, string, []byte) {
 	// verify pointers to payload
-	startPointerPos := len(entrypoint) - START_OFFSET_LEN - END_OFFSET_LEN
-	startPointerBytes := entrypoint[startPointerPos : startPointerPos+START_OFFSET_LEN]
-	startPointer := int(binary.BigEndian.Uint32(startPointerBytes))
-	endPointerPos := len(entrypoint) - END_OFFSET_LEN
-	endPointerBytes := entrypoint[endPointerPos : endPointerPos+END_OFFSET_LEN]
-	endPointer := int(binary.BigEndian.Uint32(endPointerBytes))
-	if startPointer > len(fullPURBBlob) || endPointer > len(fullPURBBlob) {
+	if fields.payloadStart > fields.payloadEnd || fields.payloadEnd > uint64(len(fullPURBBlob)) {
 		// the pointer is pointing outside the blob
 		return false, "either payload start or end pointer is invalid", nil
 	}
 
 	// compute SessionKey from entrypoint, create the decoder
-	sessionKey := entrypoint[0:startPointerPos]
-	payload := unPad(fullPURBBlob[startPointer:], endPointer-startPointer)
+	payload := unPad(fullPURBBlob[fields.payloadStart:], int(fields.payloadEnd-fields.payloadStart))
 
-	key := KDF("enc", sessionKey)
+	key := KDF(version.encLabel, fields.sessionKey)
 	msg := streamDecrypt(payload, key)
+	zeroBytes(key)
 
 	return true, "", msg
 }
@@ -16,36 +16,103 @@ const START_OFFSET_LEN = 4
 // Length (in bytes) of the pointer to the end of the payload
 const END_OFFSET_LEN = START_OFFSET_LEN
 
+// Length (in bytes) of each pointer to the payload in the entrypoints of the 64-bit format, for PURBs larger than 4 GiB
+const OFFSET_LEN_64 = 8
+
 // Length (in bytes) of the Nonce used at the beginning of the PURB
 const NONCE_LENGTH = 12
 
 // Length (in bytes) of the MAC tag in the entry point (only used with entrypoints are encrypted with AEAD)
 const MAC_AUTHENTICATION_TAG_LENGTH = 32
 
-// Structure to define the whole PURB
+// Length (in bytes) of the tag added by the AEAD (AES-GCM) when encrypting an entrypoint
+const AEAD_TAG_LENGTH = 16
+
+// EntryPointLength of the suites whose entrypoints have 32-bit pointers to the payload
+const ENTRYPOINT_LENGTH_32 = SYMMETRIC_KEY_LENGTH + START_OFFSET_LEN + END_OFFSET_LEN + AEAD_TAG_LENGTH
+
+// EntryPointLength of the suites whose entrypoints have 64-bit pointers to the payload
+const ENTRYPOINT_LENGTH_64 = SYMMETRIC_KEY_LENGTH + 2*OFFSET_LEN_64 + AEAD_TAG_LENGTH
+
+// Length (in bytes) of the format version and feature flags which start the content of a versioned entrypoint
+const ENTRYPOINT_VERSION_LEN = 2
+
+// EntryPointLength of the suites whose entrypoints carry a format version, and have 32-bit pointers to the payload
+const ENTRYPOINT_LENGTH_VERSIONED_32 = ENTRYPOINT_VERSION_LEN + ENTRYPOINT_LENGTH_32
+
+// EntryPointLength of the suites whose entrypoints carry a format version, and have 64-bit pointers to the payload
+const ENTRYPOINT_LENGTH_VERSIONED_64 = ENTRYPOINT_VERSION_LEN + ENTRYPOINT_LENGTH_64
+
+// Structure holding the encoder's state while a PURB is being built. It contains secrets, and is never returned by Encode
 type Purb struct {
 	PublicParameters *PurbPublicFixedParameters
 
 	Nonce      []byte // Nonce used in both AEAD of entrypoints and payload. The same for different entrypoints as the keys are different. It is stored in the very beginning of the purb
 	Header     *Header
-	Payload    []byte        // Payload contains already encrypted and padded plaintext
-	SessionKey []byte        // SessionKey is encapsulated and used to derive PayloadKey and MacKey
-	Recipients []Recipient   // tuple with (Suite, PublicKey, PrivateKey)
-	Stream     cipher.Stream // used to get randomness
+	Payload    []byte          // Payload contains already encrypted and padded plaintext
+	Recipients []Recipient     // tuple with (Suite, PublicKey, PrivateKey)
+	Stream     cipher.Stream   // used to get randomness
+	Options    *EncoderOptions // encoder-local settings, can be nil
 
 	byteRepresentation []byte // the end-to-end random-looking bit array returned by ToBytes() is computed at creation time
 
-	EncryptedDataLen int    // used to record the end of encrypted data in the entry points
-	OriginalData     []byte // kept to compare between "Payload" and this
-	IsVerbose        bool   // if true, the various operations on the data structure will print what is happening
+	EncryptedDataLen int  // used to record the end of encrypted data in the entry points
+	IsVerbose        bool // if true, the various operations on the data structure will print what is happening
+
+	sessionKey    []byte // encapsulated in the entrypoints and used to derive PayloadKey and MacKey. Wiped once the PURB is encoded
+	formatVersion byte   // format version of the PURB, which selects how the keys are derived from the session key
+	formatFlags   byte   // feature flags written next to the format version, in the versioned entrypoints
+}
+
+// Result of Encode: the random-looking blob and the public facts about its layout. Holds no secret material
+type EncodedPurb struct {
+	PublicParameters *PurbPublicFixedParameters
+
+	Cornerstones  []HeaderSlot // where the cornerstones were placed, sorted by offset
+	EntryPoints   []HeaderSlot // where the entrypoints were placed, sorted by offset
+	HeaderLength  int          // the payload starts right after the header
+	PayloadLength int          // length of the encrypted and padded payload
+
+	byteRepresentation []byte
+}
+
+// Position of a cornerstone or of an entrypoint in the header of an encoded PURB
+type HeaderSlot struct {
+	SuiteName string
+	Offset    int
+	Length    int
 }
 
 // This struct's contents are *not* parameters to the PURBs. Here they vary for the simulations and the plots, but they should be fixed for all purbs
 type PurbPublicFixedParameters struct {
-	SuiteInfoMap                   SuiteInfoMap // public suite information (Allowed Positions, etc)
-	SimplifiedEntrypointsPlacement bool         // If true, does not use hash tables for entrypoints
+	SuiteInfoMap         SuiteInfoMap             // public suite information (Allowed Positions, etc)
+	EntrypointsPlacement EntrypointsPlacementMode // how entrypoints are laid out in the header
 
 	HashTableCollisionLinearResolutionAttempts int // Number of attempts to shift entrypoint position in a hash table by +1 if the computed position is already occupied
+	CuckooMaxEntrypoints                       int // With PlacementCuckoo, maximum number of entrypoints (i.e., recipients) in a PURB, which sizes the tables
+
+	PaddingScheme         PaddingScheme // how the length of the whole PURB is rounded up, Padmé if nil
+	HeaderPaddingScheme   PaddingScheme // how the header is rounded up, so that its length hides the number of recipients and suites. Not padded if nil
+	HeaderCoverRecipients int           // the header is at least as long as one holding this many entrypoints, 0 for no minimum
+}
+
+// How entrypoints are laid out in the header. In every mode, the entrypoints of a suite start right after the first
+// allowed position of its cornerstone
+type EntrypointsPlacementMode int
+
+const (
+	// Hash tables of doubling sizes, with HashTableCollisionLinearResolutionAttempts linear probes in each
+	PlacementHashTable EntrypointsPlacementMode = iota
+	// One entrypoint after the other, decoders try them all
+	PlacementSimplified
+	// Cuckoo hashing into a table sized from CuckooMaxEntrypoints: decoders probe at most CUCKOO_CHOICES*CUCKOO_BUCKET_SIZE slots
+	PlacementCuckoo
+)
+
+// Settings local to an encoder. Unlike PurbPublicFixedParameters, they have no influence on the PURBs produced
+type EncoderOptions struct {
+	EphemeralKeyPools map[string]*EphemeralKeyPool // suiteName -> pool of precomputed cornerstone key pairs, optional
+	Workers           int                          // goroutines deriving shared secrets and sealing entrypoints. 0 or 1 means sequential
 }
 
 // Suite defines the required functionalities for each suite from kyber
@@ -65,7 +132,7 @@ type SuiteInfoMap map[string]*SuiteInfo
 type SuiteInfo struct {
 	AllowedPositions  []int // alternative SessionKey/point position in purb header
 	CornerstoneLength int   // length of each SessionKey/point in bytes
-	EntryPointLength  int   // Length of each encrypted entry point
+	EntryPointLength  int   // Length of each encrypted entry point, ENTRYPOINT_LENGTH_32, ENTRYPOINT_LENGTH_64 or their VERSIONED variants, which selects the size of its pointers and whether it carries a format version
 }
 
 // Structure defining the actual header of a purb
@@ -73,25 +140,30 @@ type Header struct {
 	EntryPoints  map[string][]*EntryPoint // map of suiteName -> []entrypoints
 	Cornerstones map[string]*Cornerstone  // Holds sender's ephemeral private/public keys for each suite in the header
 	Layout       *RegionReservationStruct // An array of byte slices where each of the bytes slice represents a hash table entry
+
+	cornerstoneOrder []string // suite names, in the order in which the cornerstones were placed
+	paddedLength     int      // length of the header with its padding, 0 until the header is padded
 }
 
 // Ephemeral Diffie-Hellman keys for all SessionKey-holders using this suite.
 // Should have a uniform representation, e.g., an Elligator point.
 type Cornerstone struct {
 	SuiteName string
-	KeyPair   *key.Pair
 	Offset    int    // Starting byte position in the header
 	EndPos    int    // Ending byte position in the header
 	Bytes     []byte // singleton. Since calling marshalling the KeyPair is non-deterministic, at least we do it only once so prints are consistents
 	SuiteInfo *SuiteInfo
+
+	keyPair *key.Pair // the private part is wiped once the shared secrets are computed
 }
 
-//EntryPoint holds the info required to create an entrypoint for each recipient.
+// EntryPoint holds the info required to create an entrypoint for each recipient.
 type EntryPoint struct {
-	Recipient    Recipient // Recipient whom this entrypoint is for
-	SharedSecret []byte    // Ephemeral secret derived using DH
-	Offset       int       // Starting byte position in the header
-	Length       int
+	Recipient Recipient // Recipient whom this entrypoint is for
+	Offset    int       // Starting byte position in the header
+	Length    int
+
+	sharedSecret []byte // Ephemeral secret derived using DH, wiped once the PURB is encoded
 }
 
 // Recipient holds information needed to be able to encrypt anything for it
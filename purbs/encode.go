@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"sort"
 	"strconv"
 
@@ -14,36 +15,101 @@ import (
 )
 
 // Creates a struct with parameters that are *fixed* across all PURBs. Should be constants, but here it is a variable for simulating various parameters
+// (services share them as a file, see Save and LoadPublicParameters)
 func NewPublicFixedParameters(infoMap SuiteInfoMap, simplifiedEntryPointTable bool) *PurbPublicFixedParameters {
+	placement := PlacementHashTable
+	if simplifiedEntryPointTable {
+		placement = PlacementSimplified
+	}
+	return &PurbPublicFixedParameters{
+		SuiteInfoMap:         infoMap,
+		EntrypointsPlacement: placement,
+		HashTableCollisionLinearResolutionAttempts: 3,
+	}
+}
+
+// Same as NewPublicFixedParameters, with entrypoints placed by cuckoo hashing, for PURBs of up to maxEntrypoints recipients
+func NewCuckooPublicFixedParameters(infoMap SuiteInfoMap, maxEntrypoints int) *PurbPublicFixedParameters {
 	return &PurbPublicFixedParameters{
-		SuiteInfoMap:                               infoMap,
-		SimplifiedEntrypointsPlacement:             simplifiedEntryPointTable,
+		SuiteInfoMap:         infoMap,
+		EntrypointsPlacement: PlacementCuckoo,
 		HashTableCollisionLinearResolutionAttempts: 3,
+		CuckooMaxEntrypoints:                       maxEntrypoints,
+	}
+}
+
+// Creates a PURB from some data and Recipients information. The returned structure holds only the blob and public
+// layout facts; the session key, the shared secrets and the ephemeral private keys are wiped before returning
+func Encode(data []byte, recipients []Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, verbose bool) (*EncodedPurb, error) {
+	return EncodeWithOptions(data, recipients, stream, params, nil, verbose)
+}
+
+// Same as Encode, with some encoder-local options (which have no influence on the resulting format). options can be nil
+func EncodeWithOptions(data []byte, recipients []Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, options *EncoderOptions, verbose bool) (*EncodedPurb, error) {
+
+	purb, err := newPurb(recipients, stream, params, options, verbose)
+	if err != nil {
+		return nil, err
 	}
+	defer purb.wipeSecrets()
+	return purb.encodeData(data, stream)
 }
 
-// Creates a PURB from some data and Recipients information
-func Encode(data []byte, recipients []Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, verbose bool) (*Purb, error) {
+// encodeData encrypts and pads the data after the header of the PURB, then builds the blob and appends the MAC
+func (purb *Purb) encodeData(data []byte, stream cipher.Stream) (*EncodedPurb, error) {
+	if purb.IsVerbose {
+		log.LLvlf3("Original data %v", data)
+	}
+
+	// the entrypoints must be able to point to the end of the payload
+	if err := purb.checkPayloadEnd(purb.Header.Length() + len(data)); err != nil {
+		return nil, err
+	}
+
+	// creation of the encrypted payload
+	purb.encryptThenPadData(data, stream)
+
+	// converts everything to []byte, performs the XOR trick on the cornerstones
+	if err := purb.placePayloadAndCornerstones(stream); err != nil {
+		return nil, err
+	}
+
+	// computes and appends HMAC to a byte representation of a full purb
+	purb.addMAC()
+
+	return purb.toEncodedPurb(), nil
+}
+
+// newPurb creates the PURB datastructure with its nonce and session key, and places the cornerstones and the
+// entrypoints. The caller must wipe its secrets once done; on error, they are already wiped
+func newPurb(recipients []Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, options *EncoderOptions, verbose bool) (*Purb, error) {
+
+	// reject unusable recipients before any secret is derived from their keys
+	if err := validateRecipients(recipients, params.SuiteInfoMap); err != nil {
+		return nil, err
+	}
 
 	// create the PURB datastructure
 	purb := &Purb{
 		Nonce:            nil,
 		Header:           nil,
 		Payload:          nil,
-		SessionKey:       nil,
 		Recipients:       recipients,
 		Stream:           stream,
-		OriginalData:     data, // just for statistics
 		PublicParameters: params,
+		Options:          options,
 		IsVerbose:        verbose,
 	}
+	if err := purb.setFormat(CURRENT_FORMAT_VERSION, 0); err != nil {
+		return nil, err
+	}
 
 	// creation of the global Nonce and random playload key
 	purb.Nonce = purb.randomBytes(NONCE_LENGTH)
-	purb.SessionKey = purb.randomBytes(SYMMETRIC_KEY_LENGTH)
+	purb.sessionKey = purb.randomBytes(SYMMETRIC_KEY_LENGTH)
 
 	if purb.IsVerbose {
-		log.LLvlf3("Created an empty PURB, original data %v, payload key %v, nonce %v", data, purb.SessionKey, purb.Nonce)
+		log.LLvlf3("Created an empty PURB, payload key %v, nonce %v", purb.sessionKey, purb.Nonce)
 		log.LLvlf3("Recipients %+v", recipients)
 		for i := range purb.PublicParameters.SuiteInfoMap {
 			log.LLvlf3("SuiteInfoMap [%v]: len %v, positions %+v", i, purb.PublicParameters.SuiteInfoMap[i].CornerstoneLength, purb.PublicParameters.SuiteInfoMap[i].AllowedPositions)
@@ -51,38 +117,58 @@ func Encode(data []byte, recipients []Recipient, stream cipher.Stream, params *P
 	}
 
 	// creation of the entrypoints and cornerstones, places entrypoint and cornerstones
-	purb.CreateHeader()
-
-	// creation of the encrypted payload
-	purb.encryptThenPadData(data, stream)
-
-	// converts everything to []byte, performs the XOR trick on the cornerstones
-	purb.placePayloadAndCornerstones(stream)
-
-	// computes and appends HMAC to a byte representation of a full purb
-	purb.addMAC()
-
+	if err := purb.CreateHeader(); err != nil {
+		purb.wipeSecrets()
+		return nil, err
+	}
 	return purb, nil
 }
 
 // Construct header computes and finds an appropriate placements for the Entrypoints and the Cornerstones
-func (purb *Purb) CreateHeader() {
+func (purb *Purb) CreateHeader() error {
 
-	purb.Header = newEmptyHeader()
+	for attempt := 0; ; attempt++ {
+		purb.Header = newEmptyHeader()
 
-	purb.createCornerstones()
-	purb.createEntryPoints()
-	purb.placeCornerstones()
+		if err := purb.createCornerstones(); err != nil {
+			return err
+		}
+		purb.createEntryPoints()
+		if err := purb.placeCornerstones(); err != nil {
+			return err
+		}
 
-	if purb.PublicParameters.SimplifiedEntrypointsPlacement {
-		purb.placeEntrypointsSimplified()
-	} else {
+		err := purb.placeAllEntrypoints()
+		if err == nil {
+			purb.padHeader()
+			return nil
+		}
+		if err != ErrCuckooPlacement || attempt+1 >= MAX_CUCKOO_HEADER_ATTEMPTS {
+			return err
+		}
+		// fresh cornerstones give fresh shared secrets, hence other candidate slots
+		purb.wipeHeaderSecrets()
+	}
+}
+
+// placeAllEntrypoints places the entrypoints according to the placement mode of the parameters
+func (purb *Purb) placeAllEntrypoints() error {
+	switch purb.PublicParameters.EntrypointsPlacement {
+	case PlacementHashTable:
 		purb.placeEntrypoints()
+	case PlacementSimplified:
+		purb.placeEntrypointsSimplified()
+	case PlacementCuckoo:
+		return purb.placeEntrypointsCuckoo()
+	default:
+		return fmt.Errorf("unknown entrypoints placement mode %v", purb.PublicParameters.EntrypointsPlacement)
 	}
+	return nil
 }
 
-// Find what unique suites used by the Recipients, generate a private for each of these suites, and assign them to corresponding entry points
-func (purb *Purb) createCornerstones() {
+// Find what unique suites used by the Recipients, generate a private for each of these suites, and assign them to corresponding entry points.
+// It fails if the hidden public keys of a suite do not fit in its CornerstoneLength
+func (purb *Purb) createCornerstones() error {
 
 	recipients := purb.Recipients
 	header := purb.Header
@@ -94,24 +180,18 @@ func (purb *Purb) createCornerstones() {
 			continue
 		}
 
+		// take a precomputed key pair if the encoder has a pool for this suite, otherwise search for one now
 		var keyPair *key.Pair
-		for {
-			// Generate a fresh SessionKey keyPair of a private SessionKey (scalar), a public SessionKey (point), and hidden encoding of the public SessionKey
-			keyPair = key.NewHidingKeyPair(recipient.Suite)
-
-			if keyPair.Private == nil || keyPair.Public == nil {
-				continue
-			}
-			if keyPair.Hiding == nil {
-				continue
-			}
-
-			if keyPair.Hiding.HideLen() > purb.PublicParameters.SuiteInfoMap[recipient.SuiteName].CornerstoneLength {
-				log.Fatal("Length of an Elligator-encoded public key is not what we expect. It's ", keyPair.Hiding.HideLen())
-			}
+		if pool := purb.Options.ephemeralKeyPool(&recipient); pool != nil {
+			keyPair = pool.Get()
+		} else {
+			keyPair = newHidingKeyPair(recipient.Suite)
+		}
 
-			// key is OK!
-			break
+		if cornerstoneLength := purb.PublicParameters.SuiteInfoMap[recipient.SuiteName].CornerstoneLength; keyPair.Hiding.HideLen() > cornerstoneLength {
+			zeroScalar(keyPair.Private)
+			return fmt.Errorf("suite %v: an Elligator-encoded public key takes %v bytes, more than the cornerstone length %v",
+				recipient.SuiteName, keyPair.Hiding.HideLen(), cornerstoneLength)
 		}
 
 		// register a new cornerstone for this suite
@@ -122,215 +202,141 @@ func (purb *Purb) createCornerstones() {
 			log.LLvlf3("Created cornerstone[%v], value %v", recipient.SuiteName, cornerstone.Bytes)
 		}
 	}
+	return nil
 }
 
-// Compute a shared secret per entrypoint used to encrypt it. It takes a public SessionKey of a recipient and multiplies it by fresh private SessionKey for a given cipher suite.
-func (purb *Purb) createEntryPoints() {
-
-	recipients := purb.Recipients
-	header := purb.Header
-
-	// create an empty entrypoint per suite, indexed per suite
-	for _, recipient := range recipients {
+// Generates a fresh key pair of a private key (scalar), a public key (point), and a hidden encoding of the public key.
+// About half of the candidates have no such encoding, hence the loop
+func newHidingKeyPair(suite Suite) *key.Pair {
+	for {
+		keyPair := key.NewHidingKeyPair(suite)
 
-		// fetch the cornerstone containing the freshly-generated public key for this suite
-		cornerstone, found := header.Cornerstones[recipient.SuiteName]
-		if !found {
-			panic("no freshly generated private SessionKey exists for this ciphersuite")
+		if keyPair.Private == nil || keyPair.Public == nil {
+			continue
 		}
-
-		// compute shared key for the entrypoint
-		recipientKey := recipient.PublicKey
-		senderKey := cornerstone.KeyPair.Private
-		sharedKey := recipientKey.Mul(senderKey, recipientKey)
-
-		if sharedKey == nil {
-			panic("couldn't negotiate a shared DH SessionKey")
+		if keyPair.Hiding == nil {
+			continue
 		}
 
-		sharedBytes, err := sharedKey.MarshalBinary()
-		if err != nil {
-			panic("error" + err.Error())
-		}
+		// key is OK!
+		return keyPair
+	}
+}
 
-		// derive a shared secret using KDF
-		sharedSecret := KDF("", sharedBytes)
+// Compute a shared secret per entrypoint used to encrypt it. It takes a public SessionKey of a recipient and multiplies it by fresh private SessionKey for a given cipher suite.
+func (purb *Purb) createEntryPoints() {
 
-		if purb.IsVerbose {
-			log.LLvlf3("Shared secret with suite=%v, entrypoint value %v", recipient.SuiteName, sharedBytes)
-		}
+	recipients := purb.Recipients
+	header := purb.Header
 
-		ep := &EntryPoint{
-			Recipient:    recipient,
-			SharedSecret: sharedSecret,
-			Offset:       -1,
-			Length:       purb.PublicParameters.SuiteInfoMap[recipient.SuiteName].EntryPointLength,
-		}
+	// the DH and the KDF dominate encoding for large recipient lists, hence are spread across goroutines. Each
+	// entrypoint goes to its own slot, and slots are registered in the recipients' order below, so that the layout does
+	// not depend on the scheduling
+	entrypoints := make([]*EntryPoint, len(recipients))
+	parallelFor(len(recipients), purb.Options.workers(), func(i int) {
+		entrypoints[i] = purb.newEntryPoint(recipients[i])
+	})
+
+	// create an empty entrypoint per suite, indexed per suite
+	for _, ep := range entrypoints {
+		suiteName := ep.Recipient.SuiteName
 
 		// store entrypoint
-		if len(header.EntryPoints[recipient.SuiteName]) == 0 {
-			header.EntryPoints[recipient.SuiteName] = make([]*EntryPoint, 0)
+		if len(header.EntryPoints[suiteName]) == 0 {
+			header.EntryPoints[suiteName] = make([]*EntryPoint, 0)
 		}
 
-		header.EntryPoints[recipient.SuiteName] = append(header.EntryPoints[recipient.SuiteName], ep)
+		header.EntryPoints[suiteName] = append(header.EntryPoints[suiteName], ep)
 	}
-}
 
-func placeCornerstonesHelper(
-	mainLayout *RegionReservationStruct,
-	secondaryLayout *RegionReservationStruct,
-	cornerstonesToPlace []*Cornerstone,
-	placedCornerstones []*Cornerstone,
-	verbose bool) []*Cornerstone {
-
-	if len(cornerstonesToPlace) == 0 {
-		if verbose {
-			log.LLvlf3("Placed all cornerstones!")
-			for _, c := range placedCornerstones {
-				log.LLvl3("  ", c.SuiteName, "between", c.Offset, c.EndPos)
-			}
-		}
-		return placedCornerstones
+	// all shared secrets are computed, the ephemeral private keys are not needed anymore
+	for _, cornerstone := range header.Cornerstones {
+		zeroScalar(cornerstone.keyPair.Private)
 	}
+}
 
-	// iteratively try to place remaining cornerstone
-	for _, cornerstone := range cornerstonesToPlace {
-
-		// prepare datastructure for recursion, do deep copies
-		placedCornerstones2 := make([]*Cornerstone, 0)
-		for _, c := range placedCornerstones {
-			placedCornerstones2 = append(placedCornerstones2, &Cornerstone{
-				SuiteName: c.SuiteName,
-				SuiteInfo: c.SuiteInfo,
-				EndPos:    c.EndPos,
-				Offset:    c.Offset,
-			})
-		}
-		mainLayout2 := mainLayout.Clone()
-		secondaryLayout2 := secondaryLayout.Clone()
-
-		// try to place this one
-		suiteInfo := cornerstone.SuiteInfo
-		allowedPositions := cornerstone.SuiteInfo.AllowedPositions
-
-		// find the first free position in the layout. We use the "secondaryLayout" since secondary positions are *not* free for other cornerstones !
-		smallestNonConflictingIndex := -1
+// Computes the shared secret with one recipient, and returns the (not yet placed) entrypoint holding it
+func (purb *Purb) newEntryPoint(recipient Recipient) *EntryPoint {
 
-		for index, startPos := range allowedPositions {
-			endPos := startPos + suiteInfo.CornerstoneLength
+	// fetch the cornerstone containing the freshly-generated public key for this suite
+	cornerstone, found := purb.Header.Cornerstones[recipient.SuiteName]
+	if !found {
+		panic("no freshly generated private SessionKey exists for this ciphersuite")
+	}
 
-			if secondaryLayout2.IsFree(startPos, endPos) {
-				smallestNonConflictingIndex = index
-				break
-			}
-		}
+	// compute shared key for the entrypoint. The result goes to a fresh point, so the recipient's key is left untouched
+	senderKey := cornerstone.keyPair.Private
+	sharedKey := recipient.Suite.Point().Mul(senderKey, recipient.PublicKey)
 
-		// no a valid placement, return
-		if smallestNonConflictingIndex == -1 {
-			return nil
-		}
+	if sharedKey == nil {
+		panic("couldn't negotiate a shared DH SessionKey")
+	}
 
-		// We found the position for this suite, reserve it ...
-		startBit, endBit := suiteInfo.byteRangeForAllowedPositionIndex(smallestNonConflictingIndex)
-		if !mainLayout2.Reserve(startBit, endBit, true, cornerstone.SuiteName) {
-			panic("The position is supposed to be free !")
-		}
-		for _, startPos := range allowedPositions {
-			endPos := startPos + suiteInfo.CornerstoneLength
+	sharedBytes, err := sharedKey.MarshalBinary()
+	if err != nil {
+		panic("error" + err.Error())
+	}
 
-			// we don't care if we get those bytes exclusively (hence requireFree=false), we just want to prevent
-			// future suites/cornerstone from using them as a primary position
-			secondaryLayout2.Reserve(startPos, endPos, false, cornerstone.SuiteName)
-		}
-		placedCornerstones2 = append(placedCornerstones2, &Cornerstone{
-			SuiteName: cornerstone.SuiteName,
-			Offset:    startBit,
-			EndPos:    endBit,
-		})
+	// derive a shared secret using KDF
+	sharedSecret := KDF("", sharedBytes)
 
-		if verbose {
-			log.LLvl3("Attempting position", startBit, endBit, "for suite", cornerstone.SuiteName)
-		}
+	if purb.IsVerbose {
+		log.LLvlf3("Shared secret with suite=%v, entrypoint value %v", recipient.SuiteName, sharedBytes)
+	}
 
-		// filter the one we just placed
-		remainingCornerstones := make([]*Cornerstone, 0)
-		for _, c := range cornerstonesToPlace {
-			if c.SuiteName != cornerstone.SuiteName {
-				remainingCornerstones = append(remainingCornerstones, &Cornerstone{
-					SuiteName: c.SuiteName,
-					SuiteInfo: c.SuiteInfo,
-					EndPos:    c.EndPos,
-					Offset:    c.Offset,
-				})
-			}
-		}
+	// the DH output is not needed anymore, only the derived secret is
+	zeroBytes(sharedBytes)
+	sharedKey.Null()
 
-		// proceed recursively
-		res := placeCornerstonesHelper(mainLayout2, secondaryLayout2, remainingCornerstones, placedCornerstones2, verbose)
-		if res != nil {
-			// we found a solution, stop iterating
-			return res
-		}
+	return &EntryPoint{
+		Recipient:    recipient,
+		sharedSecret: sharedSecret,
+		Offset:       -1,
+		Length:       purb.PublicParameters.SuiteInfoMap[recipient.SuiteName].EntryPointLength,
 	}
-
-	return nil
 }
 
 // Writes cornerstone values to the first available entries of the ones assigned for use ciphersuites
-func (purb *Purb) placeCornerstones() {
-
-	// To compute the "main layout", we use a secondary layout to keep track of things. It is discarded at the end, and only helps computing mainLayout.
-	// Two things to remember:
-	// (1) every Suite has *multiple possible positions* for placing a cornerstone.
-	// (2) when the PURB is finalized, the decoder can XOR *all possible positions* (within the payload) to get the cornerstone
-	// In principle, when we found the primary position for a suite, we don't care what's gonna be in the remaining positions,
-	// *but* it cannot be another cornerstone since we need to ensure there is at least one degree of freedom to ensure property
-	// (2). Hence, we place cornerstone where they don't collide with other "things" in the primary payload (which is normal),
-	// but also they cannot collide with other suite's allowed positions (represented by the secondaryLayout).
-	// On the other hand, other "things" (entrypoints, data), can collide with the non-primary positions of the suites.
-	// Final note: we start by placing the "longest" (bit-wise) cornerstone since it has more chance to collide with something
-	// when placed.
+func (purb *Purb) placeCornerstones() error {
+
+	// The positions are computed by solveCornerstonePlacement, which takes care of the constraint that a cornerstone
+	// cannot be placed on an allowed position of a suite placed before it (see there). Other "things" (entrypoints,
+	// data) can collide with the non-primary positions of the suites, hence only the primary positions are reserved
 	mainLayout := purb.Header.Layout
-	secondaryLayout := NewRegionReservationStruct()
 
 	// we first reserve the spot for the nonce
 	mainLayout.Reserve(0, NONCE_LENGTH, true, "nonce")
-	secondaryLayout.Reserve(0, NONCE_LENGTH, true, "nonce")
 
-	cornerstonesToPlace := make([]*Cornerstone, 0)
-	cornerstonesPlaced := make([]*Cornerstone, 0)
-	for _, cornerstone := range purb.Header.Cornerstones {
-		cornerstonesToPlace = append(cornerstonesToPlace, cornerstone)
-	}
-
-	placedCornerstones := placeCornerstonesHelper(mainLayout, secondaryLayout, cornerstonesToPlace, cornerstonesPlaced, purb.IsVerbose)
-
-	if placedCornerstones == nil {
-		panic("Could not find a mapping for placing the cornerstone, who designed the AllowedPositions ?!")
+	placements, _, err := solveCornerstonePlacement(purb.PublicParameters.SuiteInfoMap, purb.Header.suiteNames())
+	if err != nil {
+		return err
 	}
 
 	// for each cornerstone, register its position
-	for _, cornerstone := range placedCornerstones {
+	purb.Header.cornerstoneOrder = make([]string, 0, len(placements))
+	for _, placement := range placements {
 
 		// ... in the cornerstone struct (which will be used when placing the entrypoints)
-		purb.Header.Cornerstones[cornerstone.SuiteName].Offset = cornerstone.Offset
-		purb.Header.Cornerstones[cornerstone.SuiteName].EndPos = cornerstone.EndPos
+		cornerstone := purb.Header.Cornerstones[placement.suiteName]
+		cornerstone.Offset = placement.offset
+		cornerstone.EndPos = placement.endPos
+		purb.Header.cornerstoneOrder = append(purb.Header.cornerstoneOrder, placement.suiteName)
 
 		if !mainLayout.Reserve(cornerstone.Offset, cornerstone.EndPos, true, cornerstone.SuiteName) {
-			panic("I thought we had this position reserved")
+			return fmt.Errorf("position [%v:%v] of cornerstone %v is already taken", cornerstone.Offset, cornerstone.EndPos, cornerstone.SuiteName)
 		}
 
 		if purb.IsVerbose {
 			log.LLvlf3("Position for cornerstone %v is start %v, end %v", cornerstone.SuiteName, cornerstone.Offset, cornerstone.EndPos)
 		}
 	}
+	return nil
 }
 
 // placeEntrypoints will find, place and reserve part of the header for the data
 // All hash tables start after their cornerstone.
 func (purb *Purb) placeEntrypoints() {
-	for _, cornerstone := range purb.Header.Cornerstones {
-		suite := cornerstone.SuiteName
+	for _, suite := range purb.Header.suiteNames() {
 		for entrypointID, entrypoint := range purb.Header.EntryPoints[suite] {
 
 			//hash table initialStartPos right after the cornerstone's offset-0
@@ -339,7 +345,7 @@ func (purb *Purb) placeEntrypoints() {
 			//initial hash table size
 			tableSize := 1
 			positionFound := false
-			intOfHashedValue := int(binary.BigEndian.Uint32(KDF("pos", entrypoint.SharedSecret))) // Large number to become a position
+			intOfHashedValue := int(binary.BigEndian.Uint32(KDF("pos", entrypoint.sharedSecret))) // Large number to become a position
 			var posInHashTable int
 
 			// we start with a 1-sized hash table, try to place (and break on success), otherwise it grows by 2
@@ -378,8 +384,7 @@ func (purb *Purb) placeEntrypoints() {
 // placeEntrypoints will findAllRangesStrictlyBefore, place and reserve part of the header for the data. Does not use a hash table, put the points linearly
 func (purb *Purb) placeEntrypointsSimplified() {
 
-	for _, cornerstone := range purb.Header.Cornerstones {
-		suite := cornerstone.SuiteName
+	for _, suite := range purb.Header.suiteNames() {
 		for entryPointID, entrypoint := range purb.Header.EntryPoints[suite] {
 			//hash table startPos right after the cornerstone's offset-0
 			startPos := purb.PublicParameters.SuiteInfoMap[suite].AllowedPositions[0] + purb.PublicParameters.SuiteInfoMap[suite].CornerstoneLength
@@ -424,29 +429,38 @@ func (purb *Purb) macOverlapsWithAllowedPositions(macStart, macEnd int) bool {
 }
 
 // encryptThenPadData takes plaintext data as a byte slice, encrypts it using a stream cipher,
-// then pads it with random bytes using Padmé
+// then pads it with random bytes using the padding scheme of the parameters
 func (purb *Purb) encryptThenPadData(data []byte, stream cipher.Stream) {
-	payloadKey := KDF("enc", purb.SessionKey)
+	purb.encryptData(data)
+
+	// padding scheme (Padmé by default), plus one more padding step each time the MAC would overlap with some allowed
+	// cornerstone position
+	paddedLength := paddedPayloadLength(purb.EncryptedDataLen, purb.Header.Length(), purb.PublicParameters.paddingScheme(), purb.macOverlapsWithAllowedPositions)
+	purb.padPayload(paddedLength)
+}
+
+// encryptData encrypts the plaintext with a key derived from the session key, into an unpadded Payload
+func (purb *Purb) encryptData(data []byte) {
+	payloadKey := KDF(formatVersions[purb.formatVersion].encLabel, purb.sessionKey)
 	encryptedData := streamEncrypt(data, payloadKey)
+	zeroBytes(payloadKey)
 	purb.EncryptedDataLen = len(encryptedData)
+	purb.Payload = encryptedData
 	if purb.IsVerbose {
 		log.LLvlf3("Payload encrypted to %v (len %v)", encryptedData, len(encryptedData))
 	}
+}
 
-	purb.Payload = pad(encryptedData, purb.Header.Length()+MAC_AUTHENTICATION_TAG_LENGTH)
-	// If MAC overlaps with some allowed cornerstone position, add one random byte to move to next allowed padding length
-	for purb.macOverlapsWithAllowedPositions(purb.Header.Length()+len(purb.Payload), purb.Header.Length()+len(purb.Payload)+MAC_AUTHENTICATION_TAG_LENGTH) {
-		randomByte := make([]byte, 1)
-		random.Bytes(randomByte, random.New())
-		purb.Payload = pad(append(purb.Payload, randomByte...), purb.Header.Length()+MAC_AUTHENTICATION_TAG_LENGTH)
-	}
+// padPayload appends random bytes to the encrypted payload, up to paddedLength
+func (purb *Purb) padPayload(paddedLength int) {
+	purb.Payload = append(purb.Payload[:purb.EncryptedDataLen], getRandomBytes(paddedLength-purb.EncryptedDataLen)...)
 	if purb.IsVerbose {
-		log.LLvlf3("Encrypted payload padded from %v to %v bytes", len(encryptedData), len(purb.Payload))
+		log.LLvlf3("Encrypted payload padded from %v to %v bytes", purb.EncryptedDataLen, len(purb.Payload))
 	}
 }
 
 // placePayloadAndCornerstones writes content of entrypoints and encrypted payloads into contiguous buffer
-func (purb *Purb) placePayloadAndCornerstones(stream cipher.Stream) {
+func (purb *Purb) placePayloadAndCornerstones(stream cipher.Stream) error {
 	buffer := new(GrowableBuffer)
 
 	// copy nonce
@@ -473,38 +487,70 @@ func (purb *Purb) placePayloadAndCornerstones(stream cipher.Stream) {
 		}
 	}
 
-	// record payload start and payload end
-	payloadStartOffset := make([]byte, START_OFFSET_LEN)
-	binary.BigEndian.PutUint32(payloadStartOffset, uint32(purb.Header.Length()))
-	payloadEndOffset := make([]byte, END_OFFSET_LEN)
-	binary.BigEndian.PutUint32(payloadEndOffset, uint32(purb.Header.Length()+purb.EncryptedDataLen))
+	// record payload start and payload end, in the layout given by the entrypoint length of each suite
+	payloadStart := purb.Header.Length()
+	payloadEnd := purb.Header.Length() + purb.EncryptedDataLen
+	contents := make(map[int][]byte)
+	for suiteName := range purb.Header.EntryPoints {
+		entryPointLength := purb.PublicParameters.SuiteInfoMap[suiteName].EntryPointLength
+		if _, ok := contents[entryPointLength]; ok {
+			continue
+		}
+		content, err := entrypointContent(purb.sessionKey, payloadStart, payloadEnd, entryPointLength, purb.formatVersion, purb.formatFlags)
+		if err != nil {
+			return err
+		}
+		contents[entryPointLength] = content
+	}
+	defer func() {
+		for _, content := range contents {
+			zeroBytes(content)
+		}
+	}()
 
-	// encrypt and copy entrypoints
-	entrypointContent := append(purb.SessionKey, payloadStartOffset...)
-	entrypointContent = append(entrypointContent, payloadEndOffset...)
+	// grow the buffer once, so that the regions below stay valid while the entrypoints are sealed in parallel
+	entrypoints := make([]*EntryPoint, 0)
 	for _, entrypointsPerSuite := range purb.Header.EntryPoints {
 		for _, entrypoint := range entrypointsPerSuite {
-			startPos := entrypoint.Offset
-			endPos := startPos + entrypoint.Length
-			region := buffer.growAndGetRegion(startPos, endPos)
-
-			// we use shared secret as a seed to a Stream cipher
-			entrypointKey := KDF("key", entrypoint.SharedSecret)
-			encrypted, err := aeadEncrypt(entrypointContent, purb.Nonce, entrypointKey, nil, stream)
-			for i := range encrypted {
-				region[i] = encrypted[i]
-			}
-			if err != nil {
-				log.Fatal(err.Error())
-			}
+			entrypoints = append(entrypoints, entrypoint)
+			buffer.growAndGetRegion(entrypoint.Offset, entrypoint.Offset+entrypoint.Length)
+		}
+	}
+	regions := make([][]byte, len(entrypoints))
+	for i, entrypoint := range entrypoints {
+		regions[i] = buffer.growAndGetRegion(entrypoint.Offset, entrypoint.Offset+entrypoint.Length)
+	}
 
-			if purb.IsVerbose {
-				log.LLvlf3("Adding symmetric entrypoint in [%v:%v], plaintext value %v, encrypted value %v with key %v, len %v", startPos, endPos, entrypointContent, region, entrypoint.SharedSecret, len(entrypointContent))
-			}
+	// sealing uses no randomness and the regions are disjoint, so the result does not depend on the scheduling
+	errs := make([]error, len(entrypoints))
+	parallelFor(len(entrypoints), purb.Options.workers(), func(i int) {
+		entrypoint := entrypoints[i]
+		region := regions[i]
+
+		// we use shared secret as a seed to a Stream cipher
+		entrypointContent := contents[entrypoint.Length]
+		entrypointKey := KDF("key", entrypoint.sharedSecret)
+		encrypted, err := aeadEncrypt(entrypointContent, purb.Nonce, entrypointKey, nil, stream)
+		if err != nil {
+			errs[i] = err
+			zeroBytes(entrypointKey)
+			return
+		}
+		copy(region, encrypted)
+
+		if purb.IsVerbose {
+			log.LLvlf3("Adding symmetric entrypoint in [%v:%v], plaintext value %v, encrypted value %v with key %v, len %v", entrypoint.Offset, entrypoint.Offset+entrypoint.Length, entrypointContent, region, entrypoint.sharedSecret, len(entrypointContent))
+		}
+		zeroBytes(entrypointKey)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
 	}
 
-	// Fill all unused parts of the header with random bits.
+	// Fill all unused parts of the header, including its padding, with random bits.
+	buffer.growAndGetRegion(0, purb.Header.Length())
 	fillRndFunction := func(low, high int) {
 		region := buffer.growAndGetRegion(low, high)
 		purb.Stream.XORKeyStream(region, region)
@@ -525,18 +571,12 @@ func (purb *Purb) placePayloadAndCornerstones(stream cipher.Stream) {
 	}
 	buffer.append(purb.Payload)
 
-	// sort cornerstone by order of apparition in the header
-	cornerstones := make([]*Cornerstone, 0)
-	for _, stone := range purb.Header.Cornerstones {
-		cornerstones = append(cornerstones, stone)
-	}
-	sort.Slice(cornerstones, func(i, j int) bool {
-		return cornerstones[i].Offset < cornerstones[j].Offset
-	})
-
 	// XOR each cornerstone with the data in its non-selected positions, and save as the cornerstone value
-	// (hence, the XOR of all positions = the cornerstone)
-	for _, cornerstone := range cornerstones {
+	// (hence, the XOR of all positions = the cornerstone). This must follow the placement order: a cornerstone's
+	// primary position never overlaps the positions of the cornerstones placed before it, so writing it does not
+	// break their XOR
+	for _, suiteName := range purb.Header.cornerstoneOrder {
+		cornerstone := purb.Header.Cornerstones[suiteName]
 
 		cornerstoneLength := len(cornerstone.Bytes)
 		xorOfAllPositions := make([]byte, cornerstoneLength)
@@ -571,14 +611,16 @@ func (purb *Purb) placePayloadAndCornerstones(stream cipher.Stream) {
 	}
 
 	purb.byteRepresentation = buffer.toBytes()
+	return nil
 }
 
 // addMAC computes HMAC over a byte representation of a complete PURB
 func (purb *Purb) addMAC() {
-	macKey := KDF("mac", purb.SessionKey)
+	macKey := KDF(formatVersions[purb.formatVersion].macLabel, purb.sessionKey)
 	mac := hmac.New(sha256.New, macKey)
 	mac.Write(purb.byteRepresentation)
 	tag := mac.Sum(nil)
+	zeroBytes(macKey)
 	purb.byteRepresentation = append(purb.byteRepresentation, tag...)
 }
 
@@ -591,12 +633,88 @@ func (purb *Purb) ToBytes() []byte {
 	return purb.byteRepresentation
 }
 
+// wipeSecrets overwrites the session key, the shared secrets and the ephemeral private keys held by the PURB
+func (purb *Purb) wipeSecrets() {
+	zeroBytes(purb.sessionKey)
+	purb.sessionKey = nil
+
+	purb.wipeHeaderSecrets()
+}
+
+// wipeHeaderSecrets zeroes the shared secrets and the cornerstones' private keys of the current header
+func (purb *Purb) wipeHeaderSecrets() {
+	if purb.Header == nil {
+		return
+	}
+	for _, entrypoints := range purb.Header.EntryPoints {
+		for _, entrypoint := range entrypoints {
+			zeroBytes(entrypoint.sharedSecret)
+			entrypoint.sharedSecret = nil
+		}
+	}
+	for _, cornerstone := range purb.Header.Cornerstones {
+		if cornerstone.keyPair != nil {
+			zeroScalar(cornerstone.keyPair.Private)
+		}
+	}
+}
+
+// toEncodedPurb extracts the blob and the public layout facts from the PURB, leaving all secrets behind
+func (purb *Purb) toEncodedPurb() *EncodedPurb {
+	encoded := &EncodedPurb{
+		PublicParameters:   purb.PublicParameters,
+		Cornerstones:       make([]HeaderSlot, 0),
+		EntryPoints:        make([]HeaderSlot, 0),
+		HeaderLength:       purb.Header.Length(),
+		PayloadLength:      len(purb.Payload),
+		byteRepresentation: purb.byteRepresentation,
+	}
+
+	for _, cornerstone := range purb.Header.Cornerstones {
+		encoded.Cornerstones = append(encoded.Cornerstones, HeaderSlot{
+			SuiteName: cornerstone.SuiteName,
+			Offset:    cornerstone.Offset,
+			Length:    len(cornerstone.Bytes),
+		})
+	}
+	for suiteName, entrypoints := range purb.Header.EntryPoints {
+		for _, entrypoint := range entrypoints {
+			encoded.EntryPoints = append(encoded.EntryPoints, HeaderSlot{
+				SuiteName: suiteName,
+				Offset:    entrypoint.Offset,
+				Length:    entrypoint.Length,
+			})
+		}
+	}
+	sort.Slice(encoded.Cornerstones, func(i, j int) bool {
+		return encoded.Cornerstones[i].Offset < encoded.Cornerstones[j].Offset
+	})
+	sort.Slice(encoded.EntryPoints, func(i, j int) bool {
+		return encoded.EntryPoints[i].Offset < encoded.EntryPoints[j].Offset
+	})
+
+	return encoded
+}
+
+// ToBytes get the []byte representation of the PURB
+func (encoded *EncodedPurb) ToBytes() []byte {
+	return encoded.byteRepresentation
+}
+
 func (purb *Purb) randomBytes(length int) []byte {
 	buffer := make([]byte, length)
 	random.Bytes(buffer, purb.Stream)
 	return buffer
 }
 
+// workers returns the number of goroutines to use for per-recipient work
+func (options *EncoderOptions) workers() int {
+	if options == nil || options.Workers < 1 {
+		return 1
+	}
+	return options.Workers
+}
+
 func newEmptyHeader() *Header {
 	return &Header{
 		EntryPoints:  make(map[string][]*EntryPoint),
@@ -615,7 +733,7 @@ func (purb *Purb) newCornerStone(suiteName string, keyPair *key.Pair) *Cornersto
 	return &Cornerstone{
 		SuiteName: suiteName,
 		Offset:    -1,
-		KeyPair:   keyPair, // do not call Hiding.HideEncode on this! it has been done already. Use bytes
+		keyPair:   keyPair, // do not call Hiding.HideEncode on this! it has been done already. Use bytes
 		Bytes:     hiddenBytes2,
 		SuiteInfo: purb.PublicParameters.SuiteInfoMap[suiteName],
 	}
@@ -628,8 +746,26 @@ func (si *SuiteInfo) byteRangeForAllowedPositionIndex(index int) (int, int) {
 	return low, high
 }
 
-// Compute the length of the header when transformed to []byte
+// Returns the names of the suites used in the header, sorted, so that the layout does not depend on map ordering
+func (h *Header) suiteNames() []string {
+	names := make([]string, 0, len(h.Cornerstones))
+	for suiteName := range h.Cornerstones {
+		names = append(names, suiteName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compute the length of the header when transformed to []byte, padding included
 func (h *Header) Length() int {
+	if length := h.contentLength(); length > h.paddedLength {
+		return length
+	}
+	return h.paddedLength
+}
+
+// Compute the length of the header up to the end of the last cornerstone or entrypoint
+func (h *Header) contentLength() int {
 	length := NONCE_LENGTH
 
 	for _, entryPoints := range h.EntryPoints {
@@ -0,0 +1,188 @@
+package purbs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrPayloadTooLarge is returned when the end of the payload cannot be expressed in the entrypoints of some recipient
+var ErrPayloadTooLarge = errors.New("payload too large for the entrypoint pointers")
+
+// ErrUnversionedEntrypoints is returned when a recipient's suite uses unversioned entrypoints, which decoders read as
+// FORMAT_VERSION_0, but the PURB needs a version deriving its keys otherwise, or feature flags
+var ErrUnversionedEntrypoints = errors.New("unversioned entrypoints cannot carry the format of this PURB")
+
+// Hidden format versions. The version travels inside the encrypted entrypoints, so only the recipients learn it.
+// Entrypoints of length ENTRYPOINT_LENGTH_32 or ENTRYPOINT_LENGTH_64 carry no version and follow FORMAT_VERSION_0;
+// the versioned ones (ENTRYPOINT_LENGTH_VERSIONED_32 or _64) start with the version and the feature flags
+const (
+	FORMAT_VERSION_0 = 0 // session key, start and end of the payload
+	FORMAT_VERSION_1 = 1 // version and feature flags, then as FORMAT_VERSION_0
+)
+
+// The version written in versioned entrypoints
+const CURRENT_FORMAT_VERSION = FORMAT_VERSION_1
+
+// How a version derives its keys. Changing a label, a pointer or the layout of the entrypoints requires a new version,
+// so that the blobs of the previous ones stay decodable. The entrypoints of a PURB share its payload and its MAC, hence
+// its version: the encoder refuses suites with unversioned entrypoints once the version of the PURB derives its keys
+// otherwise than FORMAT_VERSION_0 (see setFormat)
+type formatVersion struct {
+	encLabel   string // KDF label of the payload key
+	macLabel   string // KDF label of the MAC key
+	knownFlags byte   // the feature flags a decoder understands; an entrypoint with other flags is rejected
+}
+
+// Feature flags of FORMAT_VERSION_1. A decoder rejects the flags it does not know, so they mark what it must understand
+const (
+	FORMAT_FLAG_METADATA = 0x01 // the data starts with a metadata envelope, see EncodeWithMetadata
+)
+
+// The versions Decode dispatches on
+var formatVersions = map[byte]*formatVersion{
+	FORMAT_VERSION_0: {encLabel: "enc", macLabel: "mac"},
+	FORMAT_VERSION_1: {encLabel: "enc", macLabel: "mac", knownFlags: FORMAT_FLAG_METADATA},
+}
+
+// sameKeys tells whether two versions derive the same keys from a session key
+func (version *formatVersion) sameKeys(other *formatVersion) bool {
+	return version.encLabel == other.encLabel && version.macLabel == other.macLabel
+}
+
+// The plaintext of an entrypoint
+type entrypointFields struct {
+	version      byte
+	flags        byte
+	sessionKey   []byte
+	payloadStart uint64
+	payloadEnd   uint64
+}
+
+// entrypointLayout returns the length of each payload pointer in an entrypoint of this length, and whether the
+// entrypoint starts with a format version
+func entrypointLayout(entryPointLength int) (offsetLen int, versioned bool, err error) {
+	switch entryPointLength {
+	case ENTRYPOINT_LENGTH_32:
+		return START_OFFSET_LEN, false, nil
+	case ENTRYPOINT_LENGTH_64:
+		return OFFSET_LEN_64, false, nil
+	case ENTRYPOINT_LENGTH_VERSIONED_32:
+		return START_OFFSET_LEN, true, nil
+	case ENTRYPOINT_LENGTH_VERSIONED_64:
+		return OFFSET_LEN_64, true, nil
+	}
+	return 0, false, fmt.Errorf("entrypoint length %v is none of %v, %v, %v and %v", entryPointLength,
+		ENTRYPOINT_LENGTH_32, ENTRYPOINT_LENGTH_64, ENTRYPOINT_LENGTH_VERSIONED_32, ENTRYPOINT_LENGTH_VERSIONED_64)
+}
+
+// maxPayloadEnd returns the largest payload end which pointers of this length can express
+func maxPayloadEnd(offsetLen int) uint64 {
+	if offsetLen == START_OFFSET_LEN {
+		return math.MaxUint32
+	}
+	return math.MaxInt64
+}
+
+// checkPayloadEnd checks that every entrypoint of the PURB can point to a payload ending at payloadEnd
+func (purb *Purb) checkPayloadEnd(payloadEnd int) error {
+	for suiteName := range purb.Header.EntryPoints {
+		offsetLen, _, err := entrypointLayout(purb.PublicParameters.SuiteInfoMap[suiteName].EntryPointLength)
+		if err != nil {
+			return err
+		}
+		if payloadEnd < 0 || uint64(payloadEnd) > maxPayloadEnd(offsetLen) {
+			return ErrPayloadTooLarge
+		}
+	}
+	return nil
+}
+
+// setFormat sets the format version and the feature flags of the PURB. Every recipient's entrypoints must be able to
+// carry them: unversioned entrypoints are read as FORMAT_VERSION_0, without flags
+func (purb *Purb) setFormat(version, flags byte) error {
+	format, ok := formatVersions[version]
+	if !ok || version == FORMAT_VERSION_0 {
+		return fmt.Errorf("cannot encode with format version %v", version)
+	}
+	if flags&^format.knownFlags != 0 {
+		return fmt.Errorf("unsupported feature flags %#02x for format version %v", flags&^format.knownFlags, version)
+	}
+	for _, recipient := range purb.Recipients {
+		_, versioned, err := entrypointLayout(purb.PublicParameters.SuiteInfoMap[recipient.SuiteName].EntryPointLength)
+		if err != nil {
+			return err
+		}
+		if !versioned && (flags != 0 || !format.sameKeys(formatVersions[FORMAT_VERSION_0])) {
+			return fmt.Errorf("%w: suite %v, format version %v, flags %#02x", ErrUnversionedEntrypoints, recipient.SuiteName, version, flags)
+		}
+	}
+	purb.formatVersion = version
+	purb.formatFlags = flags
+	return nil
+}
+
+// entrypointContent returns the plaintext of an entrypoint of this length: the format version and the flags if it is
+// versioned, then the session key, and the start and the end of the payload
+func entrypointContent(sessionKey []byte, payloadStart, payloadEnd, entryPointLength int, version, flags byte) ([]byte, error) {
+	offsetLen, versioned, err := entrypointLayout(entryPointLength)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, entryPointLength-AEAD_TAG_LENGTH)
+	rest := content
+	if versioned {
+		content[0] = version
+		content[1] = flags
+		rest = content[ENTRYPOINT_VERSION_LEN:]
+	}
+	copy(rest, sessionKey)
+	putOffset(rest[SYMMETRIC_KEY_LENGTH:SYMMETRIC_KEY_LENGTH+offsetLen], payloadStart)
+	putOffset(rest[SYMMETRIC_KEY_LENGTH+offsetLen:], payloadEnd)
+	return content, nil
+}
+
+// parseEntrypointContent splits the plaintext of an entrypoint, whose layout follows from its length. It rejects the
+// versions and the flags this decoder does not know. The session key points into content
+func parseEntrypointContent(content []byte) (*entrypointFields, error) {
+	offsetLen, versioned, err := entrypointLayout(len(content) + AEAD_TAG_LENGTH)
+	if err != nil {
+		return nil, fmt.Errorf("entrypoint content of invalid length %v", len(content))
+	}
+	fields := &entrypointFields{version: FORMAT_VERSION_0}
+	if versioned {
+		fields.version = content[0]
+		fields.flags = content[1]
+		content = content[ENTRYPOINT_VERSION_LEN:]
+		if fields.version == FORMAT_VERSION_0 {
+			return nil, errors.New("versioned entrypoint with format version 0")
+		}
+	}
+	version, ok := formatVersions[fields.version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format version %v", fields.version)
+	}
+	if fields.flags&^version.knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported feature flags %#02x for format version %v", fields.flags&^version.knownFlags, fields.version)
+	}
+	fields.sessionKey = content[:SYMMETRIC_KEY_LENGTH]
+	fields.payloadStart = readOffset(content[SYMMETRIC_KEY_LENGTH : SYMMETRIC_KEY_LENGTH+offsetLen])
+	fields.payloadEnd = readOffset(content[SYMMETRIC_KEY_LENGTH+offsetLen:])
+	return fields, nil
+}
+
+func putOffset(b []byte, offset int) {
+	if len(b) == START_OFFSET_LEN {
+		binary.BigEndian.PutUint32(b, uint32(offset))
+	} else {
+		binary.BigEndian.PutUint64(b, uint64(offset))
+	}
+}
+
+func readOffset(b []byte) uint64 {
+	if len(b) == START_OFFSET_LEN {
+		return uint64(binary.BigEndian.Uint32(b))
+	}
+	return binary.BigEndian.Uint64(b)
+}
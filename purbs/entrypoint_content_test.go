@@ -0,0 +1,202 @@
+package purbs
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestEntrypointContent(t *testing.T) {
+	key := getRandomBytes(SYMMETRIC_KEY_LENGTH)
+	for _, entryPointLength := range []int{ENTRYPOINT_LENGTH_32, ENTRYPOINT_LENGTH_64, ENTRYPOINT_LENGTH_VERSIONED_32, ENTRYPOINT_LENGTH_VERSIONED_64} {
+		offsetLen, versioned, err := entrypointLayout(entryPointLength)
+		require.NoError(t, err)
+		end := math.MaxUint32
+		if offsetLen == OFFSET_LEN_64 {
+			end = 1 << 42
+		}
+		content, err := entrypointContent(key, 100, end, entryPointLength, CURRENT_FORMAT_VERSION, 0)
+		require.NoError(t, err)
+		require.Len(t, content, entryPointLength-AEAD_TAG_LENGTH)
+
+		fields, err := parseEntrypointContent(content)
+		require.NoError(t, err)
+		require.Equal(t, key, fields.sessionKey)
+		require.Equal(t, uint64(100), fields.payloadStart)
+		require.Equal(t, uint64(end), fields.payloadEnd)
+		if versioned {
+			require.Equal(t, byte(CURRENT_FORMAT_VERSION), fields.version)
+		} else {
+			require.Equal(t, byte(FORMAT_VERSION_0), fields.version)
+		}
+	}
+
+	_, err := parseEntrypointContent(make([]byte, SYMMETRIC_KEY_LENGTH+3))
+	require.Error(t, err)
+}
+
+func TestEntrypointContentUnknownVersion(t *testing.T) {
+	key := getRandomBytes(SYMMETRIC_KEY_LENGTH)
+	content, err := entrypointContent(key, 100, 200, ENTRYPOINT_LENGTH_VERSIONED_32, CURRENT_FORMAT_VERSION, 0)
+	require.NoError(t, err)
+
+	// versions from the future, and version 0 which is never written with a version header, are rejected
+	for _, version := range []byte{FORMAT_VERSION_0, 0xff} {
+		content[0] = version
+		_, err = parseEntrypointContent(content)
+		require.Error(t, err)
+	}
+
+	content[0] = CURRENT_FORMAT_VERSION
+	content[1] = 0x80
+	_, err = parseEntrypointContent(content)
+	require.Error(t, err)
+}
+
+func TestEncodeVersionedEntrypoints(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(3)
+	recipients := createRecipients(3, 3, infoMap)
+
+	// unversioned, versioned and versioned with 64-bit pointers entrypoints in the same PURB
+	infoMap[recipients[1].SuiteName].EntryPointLength = ENTRYPOINT_LENGTH_VERSIONED_32
+	infoMap[recipients[2].SuiteName].EntryPointLength = ENTRYPOINT_LENGTH_VERSIONED_64
+	mixed := []*PurbPublicFixedParameters{NewPublicFixedParameters(infoMap, false), NewPublicFixedParameters(infoMap, true)}
+
+	// cuckoo tables of suites with different entrypoint lengths fit badly together, so only versioned ones there
+	versionedInfoMap := getDummySuiteInfo(3)
+	for _, info := range versionedInfoMap {
+		info.EntryPointLength = ENTRYPOINT_LENGTH_VERSIONED_32
+	}
+	versioned := []*PurbPublicFixedParameters{NewCuckooPublicFixedParameters(versionedInfoMap, len(recipients))}
+
+	for _, params := range append(mixed, versioned...) {
+		require.True(t, params.Validate().OK())
+
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
+
+func TestCheckPayloadEnd(t *testing.T) {
+	infoMap := getDummySuiteInfo(2)
+	recipients := createRecipients(1, 2, infoMap)
+	infoMap[recipients[1].SuiteName].EntryPointLength = ENTRYPOINT_LENGTH_64
+	params := NewPublicFixedParameters(infoMap, false)
+
+	// 32-bit pointers cannot point past math.MaxUint32, whatever the other suites use
+	purb, err := newPurb(recipients, random.New(), params, nil, false)
+	require.NoError(t, err)
+	defer purb.wipeSecrets()
+	require.NoError(t, purb.checkPayloadEnd(math.MaxUint32))
+	require.Equal(t, ErrPayloadTooLarge, purb.checkPayloadEnd(math.MaxUint32+1))
+	require.Equal(t, ErrPayloadTooLarge, purb.checkPayloadEnd(-1))
+
+	only64, err := newPurb(recipients[1:], random.New(), params, nil, false)
+	require.NoError(t, err)
+	defer only64.wipeSecrets()
+	require.NoError(t, only64.checkPayloadEnd(math.MaxUint32+1))
+}
+
+func TestDecodeInvalidPayloadPointers(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(1, 1, infoMap)
+	for _, params := range []*PurbPublicFixedParameters{
+		NewPublicFixedParameters(infoMap, false),
+		NewPublicFixedParameters(infoMap, true),
+		NewCuckooPublicFixedParameters(infoMap, 4),
+	} {
+		// an entrypoint which authenticates, in a PURB with a valid MAC, but points past the end of the blob
+		purb, err := newPurb(recipients, random.New(), params, nil, false)
+		require.NoError(t, err)
+		purb.encryptThenPadData([]byte("SomeInfo"), random.New())
+		purb.EncryptedDataLen += 1000
+		require.NoError(t, purb.placePayloadAndCornerstones(random.New()))
+		purb.addMAC()
+		blob := purb.ToBytes()
+		purb.wipeSecrets()
+
+		// the trial decoding moves on to the next candidates, and gives up
+		var success bool
+		done := make(chan error)
+		go func() {
+			var err error
+			success, _, err = Decode(blob, &recipients[0], params, false)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			require.False(t, success)
+			require.Error(t, err, params.EntrypointsPlacement.String())
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%v: decoding does not terminate", params.EntrypointsPlacement)
+		}
+	}
+}
+
+func TestPlacePayloadInvalidEntrypointLength(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	purb, err := newPurb(recipients, random.New(), params, nil, false)
+	require.NoError(t, err)
+	defer purb.wipeSecrets()
+	purb.encryptThenPadData([]byte("SomeInfo"), purb.Stream)
+
+	infoMap[recipients[0].SuiteName].EntryPointLength = ENTRYPOINT_LENGTH_32 + 1
+	require.Error(t, purb.placePayloadAndCornerstones(purb.Stream))
+}
+
+func TestFormatVersionWithOtherLabels(t *testing.T) {
+	// a later version deriving its keys otherwise, and knowing one feature flag
+	const version, flag = 0xfe, 0x01
+	formatVersions[version] = &formatVersion{encLabel: "enc-test", macLabel: "mac-test", knownFlags: flag}
+	defer delete(formatVersions, version)
+
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(2)
+	recipients := createRecipients(1, 2, infoMap)
+	for _, info := range infoMap {
+		info.EntryPointLength = ENTRYPOINT_LENGTH_VERSIONED_32
+	}
+	params := NewPublicFixedParameters(infoMap, false)
+
+	purb, err := newPurb(recipients, random.New(), params, nil, false)
+	require.NoError(t, err)
+	defer purb.wipeSecrets()
+	require.Error(t, purb.setFormat(version, 0x02))
+	require.NoError(t, purb.setFormat(version, flag))
+	encoded, err := purb.encodeData(data, purb.Stream)
+	require.NoError(t, err)
+
+	for _, recipient := range recipients {
+		found, decoded, err := decode(encoded.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, byte(version), decoded.version)
+		require.Equal(t, byte(flag), decoded.flags)
+		require.Equal(t, data, decoded.data)
+	}
+
+	// unversioned entrypoints would be read as version 0, with other keys: the encoder refuses them
+	infoMap[recipients[1].SuiteName].EntryPointLength = ENTRYPOINT_LENGTH_32
+	require.Equal(t, ErrUnversionedEntrypoints, errors.Unwrap(purb.setFormat(version, 0)))
+	require.NoError(t, purb.setFormat(CURRENT_FORMAT_VERSION, 0))
+	require.Equal(t, ErrUnversionedEntrypoints, errors.Unwrap(purb.setFormat(CURRENT_FORMAT_VERSION, FORMAT_FLAG_METADATA)))
+
+	// and decoders which do not know the version reject it
+	delete(formatVersions, version)
+	_, _, err = Decode(encoded.ToBytes(), &recipients[0], params, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package purbs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// padHeader rounds the length of the header up with the HeaderPaddingScheme. The slack comes after every cornerstone
+// and entrypoint, and is filled with random bytes along with the other free regions of the header
+func (purb *Purb) padHeader() {
+	params := purb.PublicParameters
+	length := purb.Header.contentLength()
+	if cover := coverHeaderLength(params, purb.Header.suiteNames()); cover > length {
+		length = cover
+	}
+	purb.Header.paddedLength = params.headerPaddingScheme().PaddedLength(length)
+}
+
+// coverHeaderLength is the length of a header in which all HeaderCoverRecipients entrypoints follow the first allowed
+// position of one of the suites, packed; the largest such length over the suites used
+func coverHeaderLength(params *PurbPublicFixedParameters, suiteNames []string) int {
+	length := 0
+	if params.HeaderCoverRecipients <= 0 {
+		return length
+	}
+	for _, suiteName := range suiteNames {
+		info := params.SuiteInfoMap[suiteName]
+		end := info.AllowedPositions[0] + info.CornerstoneLength + params.HeaderCoverRecipients*info.EntryPointLength
+		if end > length {
+			length = end
+		}
+	}
+	return length
+}
+
+// paddingScheme returns the scheme padding the whole PURB
+func (params *PurbPublicFixedParameters) paddingScheme() PaddingScheme {
+	if params.PaddingScheme == nil {
+		return PadmePadding{}
+	}
+	return params.PaddingScheme
+}
+
+// headerPaddingScheme returns the scheme padding the header. The slack between the last cornerstone or entrypoint and
+// the payload is filled with random bytes; decoders do not need to know about it, as the entrypoints point to the payload
+func (params *PurbPublicFixedParameters) headerPaddingScheme() PaddingScheme {
+	if params.HeaderPaddingScheme == nil {
+		return NoPadding{}
+	}
+	return params.HeaderPaddingScheme
+}
+
+// For each observable header length, the numbers of recipients that produced it in AnalyzeHeaderSizes
+type HeaderSizeReport struct {
+	Sizes map[int][]int // header length -> recipient counts, in increasing order
+}
+
+// AnalyzeHeaderSizes builds headers for 1 to maxRecipients recipients, trials times each, and records which header
+// lengths (padding included) each number of recipients produces. recipients(n) returns n recipients; the suites it
+// uses matter, as the header depends on them. An observer who sees a header length learns that the number of
+// recipients is one of those mapped to it
+func AnalyzeHeaderSizes(params *PurbPublicFixedParameters, recipients func(n int) []Recipient, maxRecipients, trials int) (*HeaderSizeReport, error) {
+	if maxRecipients < 1 || trials < 1 {
+		return nil, errors.New("maxRecipients and trials must be positive")
+	}
+	seen := make(map[int]map[int]bool)
+	for n := 1; n <= maxRecipients; n++ {
+		for trial := 0; trial < trials; trial++ {
+			purb := &Purb{
+				Recipients:       recipients(n),
+				Stream:           random.New(),
+				PublicParameters: params,
+			}
+			err := purb.CreateHeader()
+			length := 0
+			if err == nil {
+				length = purb.Header.Length()
+			}
+			purb.wipeHeaderSecrets()
+			if err != nil {
+				return nil, fmt.Errorf("%v recipients: %v", n, err)
+			}
+
+			if seen[length] == nil {
+				seen[length] = make(map[int]bool)
+			}
+			seen[length][n] = true
+		}
+	}
+
+	report := &HeaderSizeReport{Sizes: make(map[int][]int)}
+	for length, counts := range seen {
+		for n := range counts {
+			report.Sizes[length] = append(report.Sizes[length], n)
+		}
+		sort.Ints(report.Sizes[length])
+	}
+	return report, nil
+}
+
+// SmallestSet returns the smallest number of recipient counts sharing a header length, i.e., how well the worst
+// observable length hides the number of recipients
+func (report *HeaderSizeReport) SmallestSet() int {
+	smallest := 0
+	for _, counts := range report.Sizes {
+		if smallest == 0 || len(counts) < smallest {
+			smallest = len(counts)
+		}
+	}
+	return smallest
+}
+
+func (report *HeaderSizeReport) String() string {
+	lengths := make([]int, 0, len(report.Sizes))
+	for length := range report.Sizes {
+		lengths = append(lengths, length)
+	}
+	sort.Ints(lengths)
+
+	lines := make([]string, 0, len(lengths))
+	for _, length := range lengths {
+		counts := report.Sizes[length]
+		lines = append(lines, fmt.Sprintf("%v bytes: %v recipient counts %v", length, len(counts), counts))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestHeaderPadding(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(2)
+	recipients := createRecipients(3, 2, infoMap)
+
+	for _, params := range []*PurbPublicFixedParameters{
+		{HeaderPaddingScheme: PadmePadding{}},
+		{HeaderPaddingScheme: BucketsPadding{Buckets: []int{256, 1024}}},
+		{HeaderPaddingScheme: BucketsPadding{Buckets: []int{256, 1024}}, HeaderCoverRecipients: 20},
+	} {
+		params.SuiteInfoMap = infoMap
+		params.HashTableCollisionLinearResolutionAttempts = 3
+		require.True(t, params.Validate().OK())
+
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		require.Equal(t, params.HeaderPaddingScheme.PaddedLength(purb.HeaderLength), purb.HeaderLength)
+		if params.HeaderCoverRecipients > 0 {
+			require.Equal(t, 1024, purb.HeaderLength)
+		}
+
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
+
+func TestAnalyzeHeaderSizes(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := func(n int) []Recipient {
+		return createRecipients(n, 1, infoMap)
+	}
+
+	// without padding, each number of recipients has its own header length
+	params := NewPublicFixedParameters(infoMap, true)
+	report, err := AnalyzeHeaderSizes(params, recipients, 5, 1)
+	require.NoError(t, err)
+	require.Len(t, report.Sizes, 5)
+	require.Equal(t, 1, report.SmallestSet())
+
+	// a cover of 5 recipients hides them all
+	params.HeaderCoverRecipients = 5
+	report, err = AnalyzeHeaderSizes(params, recipients, 5, 1)
+	require.NoError(t, err)
+	require.Len(t, report.Sizes, 1)
+	require.Equal(t, 5, report.SmallestSet())
+
+	_, err = AnalyzeHeaderSizes(params, recipients, 0, 1)
+	require.Error(t, err)
+}
+
+func TestValidateHeaderPadding(t *testing.T) {
+	params := NewPublicFixedParameters(getDummySuiteInfo(1), false)
+	params.HeaderPaddingScheme = BucketsPadding{}
+	require.Len(t, issuesOfKind(params.Validate(), IssueHeaderPadding), 1)
+
+	params.HeaderPaddingScheme = BucketsPadding{Buckets: []int{512, 256}}
+	require.Len(t, issuesOfKind(params.Validate(), IssueHeaderPadding), 1)
+
+	params.HeaderPaddingScheme = BucketsPadding{Buckets: []int{256, 512}}
+	params.HeaderCoverRecipients = -1
+	require.Len(t, issuesOfKind(params.Validate(), IssueHeaderPadding), 1)
+
+	params.HeaderCoverRecipients = 0
+	require.True(t, params.Validate().OK())
+}
@@ -0,0 +1,96 @@
+package purbs
+
+import (
+	"sync"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+)
+
+// EphemeralKeyPool holds fresh key pairs with an Elligator-representable public key for one suite. A background
+// goroutine keeps it filled, so that Encode does not have to search for a representable key on its latency-critical
+// path. Every key pair is handed out at most once.
+type EphemeralKeyPool struct {
+	suite    Suite
+	keyPairs chan *key.Pair
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	close    sync.Once
+}
+
+// Creates a pool holding up to "size" precomputed key pairs for this suite, and starts filling it in the background.
+// Close must be called to stop the background goroutine
+func NewEphemeralKeyPool(suite Suite, size int) *EphemeralKeyPool {
+	if size < 1 {
+		size = 1
+	}
+	pool := &EphemeralKeyPool{
+		suite:    suite,
+		keyPairs: make(chan *key.Pair, size),
+		stop:     make(chan struct{}),
+	}
+
+	pool.stopped.Add(1)
+	go pool.fill()
+
+	return pool
+}
+
+// fill generates key pairs until the pool is closed, blocking whenever the pool is full
+func (pool *EphemeralKeyPool) fill() {
+	defer pool.stopped.Done()
+	for {
+		keyPair := newHidingKeyPair(pool.suite)
+
+		select {
+		case pool.keyPairs <- keyPair:
+		case <-pool.stop:
+			zeroScalar(keyPair.Private)
+			return
+		}
+	}
+}
+
+// Get removes a key pair from the pool. If the pool is empty (or closed), a key pair is generated on the spot
+func (pool *EphemeralKeyPool) Get() *key.Pair {
+	select {
+	case keyPair := <-pool.keyPairs:
+		return keyPair
+	default:
+		return newHidingKeyPair(pool.suite)
+	}
+}
+
+// Len returns the number of key pairs ready to be used
+func (pool *EphemeralKeyPool) Len() int {
+	return len(pool.keyPairs)
+}
+
+// Close stops the background goroutine and wipes the private keys still in the pool. Get keeps working afterwards
+func (pool *EphemeralKeyPool) Close() {
+	pool.close.Do(func() {
+		close(pool.stop)
+		pool.stopped.Wait()
+
+		for {
+			select {
+			case keyPair := <-pool.keyPairs:
+				zeroScalar(keyPair.Private)
+			default:
+				return
+			}
+		}
+	})
+}
+
+// ephemeralKeyPool returns the pool to use for this recipient's suite, or nil if there is none. A pool registered under
+// the recipient's suite name but holding keys of another suite is not used
+func (options *EncoderOptions) ephemeralKeyPool(recipient *Recipient) *EphemeralKeyPool {
+	if options == nil || options.EphemeralKeyPools == nil {
+		return nil
+	}
+	pool := options.EphemeralKeyPools[recipient.SuiteName]
+	if pool == nil || pool.suite.String() != recipient.Suite.String() {
+		return nil
+	}
+	return pool
+}
@@ -0,0 +1,124 @@
+package purbs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/group/curve25519"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// waits until the pool holds n key pairs
+func waitForPool(pool *EphemeralKeyPool, n int) {
+	for pool.Len() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEphemeralKeyPool(t *testing.T) {
+	pool := NewEphemeralKeyPool(curve25519.NewBlakeSHA256Curve25519(true), 4)
+	defer pool.Close()
+	waitForPool(pool, 4)
+
+	// key pairs are hideable, and never handed out twice (also when the pool runs dry)
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		keyPair := pool.Get()
+		require.NotNil(t, keyPair.Hiding)
+		require.False(t, seen[keyPair.Public.String()])
+		seen[keyPair.Public.String()] = true
+	}
+
+	pool.Close()
+	require.Equal(t, 0, pool.Len())
+	require.NotNil(t, pool.Get().Hiding)
+}
+
+func TestEncodeWithKeyPool(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(2)
+	recipients := createRecipients(2, 2, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	options := &EncoderOptions{EphemeralKeyPools: make(map[string]*EphemeralKeyPool)}
+	for suiteName := range infoMap {
+		pool := NewEphemeralKeyPool(curve25519.NewBlakeSHA256Curve25519(true), 2)
+		defer pool.Close()
+		waitForPool(pool, 2)
+		options.EphemeralKeyPools[suiteName] = pool
+	}
+
+	for i := 0; i < 3; i++ {
+		purb, err := EncodeWithOptions(data, recipients, random.New(), params, options, false)
+		require.NoError(t, err)
+
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
+
+func benchmarkEncode(b *testing.B, withPool bool) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(3)
+	recipients := createRecipients(1, 3, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	var options *EncoderOptions
+	if withPool {
+		// pre-fill with enough keys for the whole run, so that we measure Encode with a warm pool
+		options = &EncoderOptions{EphemeralKeyPools: make(map[string]*EphemeralKeyPool)}
+		for suiteName := range infoMap {
+			pool := NewEphemeralKeyPool(curve25519.NewBlakeSHA256Curve25519(true), b.N)
+			defer pool.Close()
+			waitForPool(pool, b.N)
+			options.EphemeralKeyPools[suiteName] = pool
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeWithOptions(data, recipients, random.New(), params, options, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	benchmarkEncode(b, false)
+}
+
+func BenchmarkEncodeWithKeyPool(b *testing.B) {
+	benchmarkEncode(b, true)
+}
+
+func TestEncodeIgnoresKeyPoolOfAnotherSuite(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	// the recipients use the full group, the pool registered under their suite name does not
+	pool := NewEphemeralKeyPool(curve25519.NewBlakeSHA256Curve25519(false), 2)
+	defer pool.Close()
+	waitForPool(pool, 2)
+	options := &EncoderOptions{EphemeralKeyPools: make(map[string]*EphemeralKeyPool)}
+	for suiteName := range infoMap {
+		options.EphemeralKeyPools[suiteName] = pool
+	}
+
+	purb, err := EncodeWithOptions(data, recipients, random.New(), params, options, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, pool.Len())
+
+	for _, recipient := range recipients {
+		success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+}
@@ -0,0 +1,407 @@
+package purbs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	kyber "gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// First lines of the text forms of keys
+const (
+	PUBLIC_KEY_TEXT_HEADER = "purb public key v1"
+	IDENTITY_TEXT_HEADER   = "purb identity v1"
+)
+
+// First bytes of the binary forms of keys
+const (
+	PUBLIC_KEY_BINARY_TYPE         = 0x01
+	IDENTITY_BINARY_TYPE           = 0x02
+	IDENTITY_ENCRYPTED_BINARY_TYPE = 0x03
+)
+
+// Private keys encrypted with a passphrase: scrypt with these costs derives an AES-256-GCM key
+const (
+	KEY_ENCRYPTION_NAME = "scrypt-aes256-gcm"
+	SCRYPT_N            = 1 << 15
+	SCRYPT_R            = 8
+	SCRYPT_P            = 1
+	SCRYPT_SALT_LENGTH  = 16
+)
+
+// Errors when parsing private keys
+var (
+	ErrPassphraseRequired = errors.New("the private key is encrypted, a passphrase is required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase, or corrupted private key")
+)
+
+// How keys are serialized: a text form, self-describing and readable ("field: value" lines after a header), or a
+// compact binary form (a type byte, then fields prefixed with their length as a uvarint)
+type KeyFormat int
+
+const (
+	KeyFormatText KeyFormat = iota
+	KeyFormatBinary
+)
+
+// The public key of a recipient, as handed to the senders. The suite is resolved by name in the suite registry
+type PublicKey struct {
+	SuiteName string
+	Label     string // optional, e.g., the owner of the key
+	Suite     Suite
+	Point     kyber.Point
+}
+
+// The key pair of a recipient, which decodes the PURBs sent to its public key
+type Identity struct {
+	PublicKey
+	Private kyber.Scalar
+}
+
+// NewIdentity generates a key pair in the suite registered under suiteName
+func NewIdentity(suiteName, label string) (*Identity, error) {
+	suite, err := LookupSuite(suiteName)
+	if err != nil {
+		return nil, err
+	}
+	pair := key.NewKeyPair(suite)
+	return &Identity{PublicKey: PublicKey{SuiteName: suiteName, Label: label, Suite: suite, Point: pair.Public}, Private: pair.Private}, nil
+}
+
+// Recipient returns the recipient to give to Encode
+func (publicKey *PublicKey) Recipient() Recipient {
+	return Recipient{SuiteName: publicKey.SuiteName, Suite: publicKey.Suite, PublicKey: publicKey.Point}
+}
+
+// Recipient returns the recipient to give to Decode
+func (identity *Identity) Recipient() Recipient {
+	recipient := identity.PublicKey.Recipient()
+	recipient.PrivateKey = identity.Private
+	return recipient
+}
+
+// Marshal serializes the public key
+func (publicKey *PublicKey) Marshal(format KeyFormat) ([]byte, error) {
+	point, err := publicKey.Point.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if format == KeyFormatBinary {
+		return append([]byte{PUBLIC_KEY_BINARY_TYPE}, publicKey.binaryFields(point)...), nil
+	}
+	lines, err := publicKey.textFields(PUBLIC_KEY_TEXT_HEADER, point)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// Marshal serializes the key pair. If passphrase is not empty, the private key is encrypted with it, with randomness
+// from stream
+func (identity *Identity) Marshal(format KeyFormat, passphrase []byte, stream cipher.Stream) ([]byte, error) {
+	point, err := identity.Point.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	private, err := identity.Private.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(private)
+
+	var salt []byte
+	if len(passphrase) > 0 {
+		salt = make([]byte, SCRYPT_SALT_LENGTH)
+		random.Bytes(salt, stream)
+		if private, err = sealPrivateKey(private, passphrase, salt, identity.binaryFields(point), stream); err != nil {
+			return nil, err
+		}
+	}
+
+	if format == KeyFormatBinary {
+		fileType := byte(IDENTITY_BINARY_TYPE)
+		if salt != nil {
+			fileType = IDENTITY_ENCRYPTED_BINARY_TYPE
+		}
+		b := append([]byte{fileType}, identity.binaryFields(point)...)
+		if salt != nil {
+			b = appendLengthPrefixed(b, salt)
+		}
+		return appendLengthPrefixed(b, private), nil
+	}
+
+	lines, err := identity.textFields(IDENTITY_TEXT_HEADER, point)
+	if err != nil {
+		return nil, err
+	}
+	if salt != nil {
+		lines = append(lines, "encryption: "+KEY_ENCRYPTION_NAME, "salt: "+base64.StdEncoding.EncodeToString(salt))
+	}
+	lines = append(lines, "private: "+base64.StdEncoding.EncodeToString(private))
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// ParsePublicKey parses a public key in either form. The suite must be registered, and the key must be valid in it
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	if len(data) > 0 && data[0] == PUBLIC_KEY_BINARY_TYPE {
+		publicKey, rest, err := parseBinaryFields(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, errors.New("trailing bytes after the public key")
+		}
+		return publicKey, nil
+	}
+
+	fields, err := parseTextFields(data, PUBLIC_KEY_TEXT_HEADER, "suite", "label", "public")
+	if err != nil {
+		return nil, err
+	}
+	return newPublicKey(fields["suite"], fields["label"], fields["public"])
+}
+
+// ParseIdentity parses a key pair in either form. The passphrase is only used if the private key is encrypted
+func ParseIdentity(data []byte, passphrase []byte) (*Identity, error) {
+	var publicKey *PublicKey
+	var salt, private []byte
+	if len(data) > 0 && (data[0] == IDENTITY_BINARY_TYPE || data[0] == IDENTITY_ENCRYPTED_BINARY_TYPE) {
+		var rest []byte
+		var err error
+		if publicKey, rest, err = parseBinaryFields(data[1:]); err != nil {
+			return nil, err
+		}
+		if data[0] == IDENTITY_ENCRYPTED_BINARY_TYPE {
+			if salt, rest, err = readLengthPrefixed(rest); err != nil || len(salt) == 0 {
+				return nil, errors.New("invalid salt")
+			}
+		}
+		if private, rest, err = readLengthPrefixed(rest); err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, errors.New("trailing bytes after the identity")
+		}
+	} else {
+		fields, err := parseTextFields(data, IDENTITY_TEXT_HEADER, "suite", "label", "public", "encryption", "salt", "private")
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, err = newPublicKey(fields["suite"], fields["label"], fields["public"]); err != nil {
+			return nil, err
+		}
+		if encryption, ok := fields["encryption"]; ok {
+			if encryption != KEY_ENCRYPTION_NAME {
+				return nil, fmt.Errorf("unknown private key encryption %q", encryption)
+			}
+			if salt, err = base64.StdEncoding.DecodeString(fields["salt"]); err != nil || len(salt) == 0 {
+				return nil, errors.New("invalid salt")
+			}
+		}
+		if private, err = base64.StdEncoding.DecodeString(fields["private"]); err != nil {
+			return nil, errors.New("invalid private key encoding")
+		}
+	}
+
+	if salt != nil {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		point, err := publicKey.Point.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if private, err = openPrivateKey(private, passphrase, salt, publicKey.binaryFields(point)); err != nil {
+			return nil, err
+		}
+	}
+	defer zeroBytes(private)
+
+	scalar := publicKey.Suite.Scalar()
+	if err := scalar.UnmarshalBinary(private); err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	if !publicKey.Suite.Point().Mul(scalar, nil).Equal(publicKey.Point) {
+		return nil, errors.New("the private key does not match the public key")
+	}
+	return &Identity{PublicKey: *publicKey, Private: scalar}, nil
+}
+
+// ParsePublicKeys parses a keyring: public keys in text form, separated by empty lines
+func ParsePublicKeys(data []byte) ([]*PublicKey, error) {
+	blocks := textBlocks(data)
+	publicKeys := make([]*PublicKey, len(blocks))
+	for i, block := range blocks {
+		publicKey, err := ParsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", i+1, err)
+		}
+		publicKeys[i] = publicKey
+	}
+	return publicKeys, nil
+}
+
+// ParseIdentities parses a keyring: key pairs in text form, separated by empty lines, whose encrypted private keys
+// all use the same passphrase
+func ParseIdentities(data []byte, passphrase []byte) ([]*Identity, error) {
+	blocks := textBlocks(data)
+	identities := make([]*Identity, len(blocks))
+	for i, block := range blocks {
+		identity, err := ParseIdentity(block, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", i+1, err)
+		}
+		identities[i] = identity
+	}
+	return identities, nil
+}
+
+// newPublicKey resolves the suite, and checks the key in it
+func newPublicKey(suiteName, label, encodedPoint string) (*PublicKey, error) {
+	pointBytes, err := base64.StdEncoding.DecodeString(encodedPoint)
+	if err != nil {
+		return nil, errors.New("invalid public key encoding")
+	}
+	return newPublicKeyFromBytes(suiteName, label, pointBytes)
+}
+
+func newPublicKeyFromBytes(suiteName, label string, pointBytes []byte) (*PublicKey, error) {
+	suite, err := LookupSuite(suiteName)
+	if err != nil {
+		return nil, err
+	}
+	point := suite.Point()
+	if err := point.UnmarshalBinary(pointBytes); err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if _, err := checkPublicKey(suite, point); err != nil {
+		return nil, err
+	}
+	return &PublicKey{SuiteName: suiteName, Label: label, Suite: suite, Point: point}, nil
+}
+
+// binaryFields returns the suite name, the label and the public key, each prefixed with its length. It also
+// authenticates an encrypted private key, which is thereby bound to them
+func (publicKey *PublicKey) binaryFields(point []byte) []byte {
+	b := appendLengthPrefixed(nil, []byte(publicKey.SuiteName))
+	b = appendLengthPrefixed(b, []byte(publicKey.Label))
+	return appendLengthPrefixed(b, point)
+}
+
+func parseBinaryFields(b []byte) (*PublicKey, []byte, error) {
+	suiteName, b, err := readLengthPrefixed(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	label, b, err := readLengthPrefixed(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	point, b, err := readLengthPrefixed(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := newPublicKeyFromBytes(string(suiteName), string(label), point)
+	return publicKey, b, err
+}
+
+func (publicKey *PublicKey) textFields(header string, point []byte) ([]string, error) {
+	if strings.ContainsAny(publicKey.SuiteName, "\r\n") || strings.ContainsAny(publicKey.Label, "\r\n") {
+		return nil, errors.New("suite names and labels cannot span several lines")
+	}
+	// parseTextFields trims the values, which would no longer match the binaryFields bound to the private key
+	if strings.TrimSpace(publicKey.SuiteName) != publicKey.SuiteName || strings.TrimSpace(publicKey.Label) != publicKey.Label {
+		return nil, errors.New("suite names and labels in text cannot start or end with spaces")
+	}
+	lines := []string{header, "suite: " + publicKey.SuiteName}
+	if publicKey.Label != "" {
+		lines = append(lines, "label: "+publicKey.Label)
+	}
+	return append(lines, "public: "+base64.StdEncoding.EncodeToString(point)), nil
+}
+
+// parseTextFields checks the header, and returns the values of the "field: value" lines, which must be among known
+func parseTextFields(data []byte, header string, known ...string) (map[string]string, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if strings.TrimSpace(lines[0]) != header {
+		return nil, fmt.Errorf("not a %q file", header)
+	}
+	fields := make(map[string]string)
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		isKnown := false
+		for _, k := range known {
+			isKnown = isKnown || k == name
+		}
+		if !isKnown {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		if _, duplicate := fields[name]; duplicate {
+			return nil, fmt.Errorf("field %q is given twice", name)
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+// textBlocks splits text at empty lines
+func textBlocks(data []byte) [][]byte {
+	blocks := make([][]byte, 0)
+	for _, block := range bytes.Split(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), []byte("\n\n")) {
+		if len(bytes.TrimSpace(block)) > 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// sealPrivateKey returns nonce | AES-GCM(private), with the key derived from the passphrase
+func sealPrivateKey(private, passphrase, salt, additionalData []byte, stream cipher.Stream) ([]byte, error) {
+	aead, err := passphraseAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	random.Bytes(nonce, stream)
+	return aead.Seal(nonce, nonce, private, additionalData), nil
+}
+
+func openPrivateKey(sealed, passphrase, salt, additionalData []byte) ([]byte, error) {
+	aead, err := passphraseAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	private, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return private, nil
+}
+
+func passphraseAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,119 @@
+package purbs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestPublicKeyFormats(t *testing.T) {
+	identity, err := NewIdentity(SUITE_CURVE25519, "alice: work")
+	require.NoError(t, err)
+	for _, format := range []KeyFormat{KeyFormatText, KeyFormatBinary} {
+		b, err := identity.PublicKey.Marshal(format)
+		require.NoError(t, err)
+		publicKey, err := ParsePublicKey(b)
+		require.NoError(t, err)
+		require.Equal(t, SUITE_CURVE25519, publicKey.SuiteName)
+		require.Equal(t, "alice: work", publicKey.Label)
+		require.True(t, identity.Point.Equal(publicKey.Point))
+	}
+
+	text, err := identity.PublicKey.Marshal(KeyFormatText)
+	require.NoError(t, err)
+	for _, invalid := range [][]byte{
+		bytes.Replace(text, []byte(SUITE_CURVE25519), []byte("curve0"), 1),
+		bytes.Replace(text, []byte("public key"), []byte("private key"), 1),
+		append(text, []byte("colour: blue\n")...),
+		{PUBLIC_KEY_BINARY_TYPE, 10, 'c'},
+	} {
+		_, err := ParsePublicKey(invalid)
+		require.Error(t, err)
+	}
+}
+
+func TestIdentityFormats(t *testing.T) {
+	identity, err := NewIdentity(SUITE_CURVE25519, "alice")
+	require.NoError(t, err)
+	passphrase := []byte("correct horse battery staple")
+
+	for _, format := range []KeyFormat{KeyFormatText, KeyFormatBinary} {
+		for _, withPassphrase := range [][]byte{nil, passphrase} {
+			b, err := identity.Marshal(format, withPassphrase, random.New())
+			require.NoError(t, err)
+			parsed, err := ParseIdentity(b, withPassphrase)
+			require.NoError(t, err)
+			require.Equal(t, "alice", parsed.Label)
+			require.True(t, identity.Private.Equal(parsed.Private))
+			require.True(t, identity.Point.Equal(parsed.Point))
+		}
+
+		b, err := identity.Marshal(format, passphrase, random.New())
+		require.NoError(t, err)
+		require.False(t, bytes.Contains(b, []byte("correct horse")))
+		_, err = ParseIdentity(b, nil)
+		require.Equal(t, ErrPassphraseRequired, err)
+		_, err = ParseIdentity(b, []byte("wrong"))
+		require.Equal(t, ErrWrongPassphrase, err)
+
+		// the label is bound to the encrypted private key
+		_, err = ParseIdentity(bytes.Replace(b, []byte("alice"), []byte("carol"), 1), passphrase)
+		require.Equal(t, ErrWrongPassphrase, err)
+	}
+
+	// the text format trims values, so it refuses labels it could not give back
+	padded, err := NewIdentity(SUITE_CURVE25519, " bob ")
+	require.NoError(t, err)
+	_, err = padded.Marshal(KeyFormatText, passphrase, random.New())
+	require.Error(t, err)
+	_, err = padded.PublicKey.Marshal(KeyFormatText)
+	require.Error(t, err)
+	b, err := padded.Marshal(KeyFormatBinary, passphrase, random.New())
+	require.NoError(t, err)
+	parsed, err := ParseIdentity(b, passphrase)
+	require.NoError(t, err)
+	require.Equal(t, " bob ", parsed.Label)
+}
+
+func TestKeyrings(t *testing.T) {
+	data := []byte("SomeInfo")
+	params, err := ProfileParameters(PROFILE_CURVE25519_ONLY_V1)
+	require.NoError(t, err)
+
+	var publicRing, privateRing []byte
+	for _, label := range []string{"alice", "bob"} {
+		identity, err := NewIdentity(SUITE_CURVE25519, label)
+		require.NoError(t, err)
+		public, err := identity.PublicKey.Marshal(KeyFormatText)
+		require.NoError(t, err)
+		private, err := identity.Marshal(KeyFormatText, nil, nil)
+		require.NoError(t, err)
+		publicRing = append(append(publicRing, public...), '\n')
+		privateRing = append(append(privateRing, private...), '\n')
+	}
+
+	publicKeys, err := ParsePublicKeys(publicRing)
+	require.NoError(t, err)
+	require.Len(t, publicKeys, 2)
+	identities, err := ParseIdentities(privateRing, nil)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	recipients := []Recipient{publicKeys[0].Recipient(), publicKeys[1].Recipient()}
+	purb, err := Encode(data, recipients, random.New(), params, false)
+	require.NoError(t, err)
+	for _, identity := range identities {
+		recipient := identity.Recipient()
+		require.NoError(t, recipient.CheckSuite())
+		success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+
+	_, err = ParseIdentities(append(privateRing, []byte("purb identity v1\nsuite: curve0\n")...), nil)
+	require.True(t, errors.Is(err, ErrUnregisteredSuite))
+}
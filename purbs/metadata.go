@@ -0,0 +1,135 @@
+package purbs
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Types of the fields of a metadata envelope. Each field is its type (1 byte), the length of its value (uvarint), then
+// the value; METADATA_END, with an empty value, closes the envelope. Decoders skip the types they do not know, so new
+// fields can be added without breaking them
+const (
+	METADATA_END       = 0
+	METADATA_FILENAME  = 1 // UTF-8
+	METADATA_MIME_TYPE = 2 // UTF-8
+	METADATA_CREATED   = 3 // Unix time in nanoseconds, int64 big-endian
+	METADATA_SIZE      = 4 // uint64 big-endian
+)
+
+// What travels with the data of a PURB, e.g., in file sharing. It is encrypted and padded with the data, so it leaks
+// nothing but through the padded length. Empty values are not written
+type Metadata struct {
+	Filename string
+	MimeType string
+	Created  time.Time // creation time of the original data
+	Size     uint64    // size of the original data, e.g., before compression; 0 if unknown
+}
+
+// EncodeWithMetadata encodes the metadata and the data in an envelope (see WrapMetadata), then encodes the envelope
+// like EncodeWithOptions, with FORMAT_FLAG_METADATA in the entrypoints. The suites of all the recipients must use
+// versioned entrypoints, otherwise ErrUnversionedEntrypoints is returned
+func EncodeWithMetadata(data []byte, metadata *Metadata, recipients []Recipient, stream cipher.Stream, params *PurbPublicFixedParameters, options *EncoderOptions, verbose bool) (*EncodedPurb, error) {
+	purb, err := newPurb(recipients, stream, params, options, verbose)
+	if err != nil {
+		return nil, err
+	}
+	defer purb.wipeSecrets()
+	if err := purb.setFormat(CURRENT_FORMAT_VERSION, FORMAT_FLAG_METADATA); err != nil {
+		return nil, err
+	}
+
+	envelope := WrapMetadata(metadata, data)
+	defer zeroBytes(envelope)
+	return purb.encodeData(envelope, stream)
+}
+
+// DecodeWithMetadata decodes a PURB like Decode, and returns its metadata and its data. The metadata is nil if the
+// PURB was not created by EncodeWithMetadata
+func DecodeWithMetadata(blob []byte, recipient *Recipient, publicFixedParameters *PurbPublicFixedParameters, verbose bool) (bool, *Metadata, []byte, error) {
+	found, decoded, err := decode(blob, recipient, publicFixedParameters, verbose)
+	if err != nil || !found {
+		return found, nil, nil, err
+	}
+	return decoded.unwrapMetadata()
+}
+
+// unwrapMetadata splits the data of a decoded PURB into its metadata and its data, if the PURB has FORMAT_FLAG_METADATA
+func (decoded *decodedPurb) unwrapMetadata() (bool, *Metadata, []byte, error) {
+	if decoded.flags&FORMAT_FLAG_METADATA == 0 {
+		return true, nil, decoded.data, nil
+	}
+	metadata, data, err := UnwrapMetadata(decoded.data)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	return true, metadata, data, nil
+}
+
+// WrapMetadata returns the envelope of the metadata (which can be nil), followed by the data
+func WrapMetadata(metadata *Metadata, data []byte) []byte {
+	envelope := make([]byte, 0, len(data)+64)
+	if metadata != nil {
+		if metadata.Filename != "" {
+			envelope = appendMetadataField(envelope, METADATA_FILENAME, []byte(metadata.Filename))
+		}
+		if metadata.MimeType != "" {
+			envelope = appendMetadataField(envelope, METADATA_MIME_TYPE, []byte(metadata.MimeType))
+		}
+		if !metadata.Created.IsZero() {
+			created := make([]byte, 8)
+			binary.BigEndian.PutUint64(created, uint64(metadata.Created.UnixNano()))
+			envelope = appendMetadataField(envelope, METADATA_CREATED, created)
+		}
+		if metadata.Size != 0 {
+			size := make([]byte, 8)
+			binary.BigEndian.PutUint64(size, metadata.Size)
+			envelope = appendMetadataField(envelope, METADATA_SIZE, size)
+		}
+	}
+	envelope = appendMetadataField(envelope, METADATA_END, nil)
+	return append(envelope, data...)
+}
+
+// UnwrapMetadata splits the output of WrapMetadata into the metadata and the data, which points into envelope
+func UnwrapMetadata(envelope []byte) (*Metadata, []byte, error) {
+	metadata := new(Metadata)
+	rest := envelope
+	for {
+		if len(rest) == 0 {
+			return nil, nil, errors.New("metadata envelope without end")
+		}
+		fieldType := rest[0]
+		value, next, err := readLengthPrefixed(rest[1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("truncated metadata field of type %v", fieldType)
+		}
+		rest = next
+
+		switch fieldType {
+		case METADATA_END:
+			return metadata, rest, nil
+		case METADATA_FILENAME:
+			metadata.Filename = string(value)
+		case METADATA_MIME_TYPE:
+			metadata.MimeType = string(value)
+		case METADATA_CREATED:
+			if len(value) != 8 {
+				return nil, nil, fmt.Errorf("creation time of invalid length %v", len(value))
+			}
+			metadata.Created = time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+		case METADATA_SIZE:
+			if len(value) != 8 {
+				return nil, nil, fmt.Errorf("size of invalid length %v", len(value))
+			}
+			metadata.Size = binary.BigEndian.Uint64(value)
+		}
+		// fields of unknown types are skipped
+	}
+}
+
+func appendMetadataField(envelope []byte, fieldType byte, value []byte) []byte {
+	return appendLengthPrefixed(append(envelope, fieldType), value)
+}
@@ -0,0 +1,106 @@
+package purbs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestMetadataEnvelope(t *testing.T) {
+	data := []byte("SomeInfo")
+	metadata := &Metadata{
+		Filename: "report.pdf",
+		MimeType: "application/pdf",
+		Created:  time.Unix(1500000000, 42),
+		Size:     1 << 40,
+	}
+
+	parsed, content, err := UnwrapMetadata(WrapMetadata(metadata, data))
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+	require.Equal(t, metadata.Filename, parsed.Filename)
+	require.Equal(t, metadata.MimeType, parsed.MimeType)
+	require.True(t, metadata.Created.Equal(parsed.Created))
+	require.Equal(t, metadata.Size, parsed.Size)
+
+	// no metadata is an envelope with only METADATA_END
+	envelope := WrapMetadata(nil, data)
+	require.Len(t, envelope, len(data)+2)
+	parsed, content, err = UnwrapMetadata(envelope)
+	require.NoError(t, err)
+	require.Equal(t, &Metadata{}, parsed)
+	require.Equal(t, data, content)
+}
+
+func TestMetadataUnknownFields(t *testing.T) {
+	data := []byte("SomeInfo")
+	envelope := appendMetadataField(nil, 200, []byte("from the future"))
+	envelope = append(envelope, WrapMetadata(&Metadata{Filename: "a.txt"}, data)...)
+
+	parsed, content, err := UnwrapMetadata(envelope)
+	require.NoError(t, err)
+	require.Equal(t, "a.txt", parsed.Filename)
+	require.Equal(t, data, content)
+}
+
+func TestMetadataInvalidEnvelope(t *testing.T) {
+	envelope := WrapMetadata(&Metadata{Filename: "a.txt"}, nil)
+	for _, truncated := range [][]byte{nil, envelope[:1], envelope[:4], envelope[:len(envelope)-2]} {
+		_, _, err := UnwrapMetadata(truncated)
+		require.Error(t, err)
+	}
+
+	_, _, err := UnwrapMetadata(appendMetadataField(nil, METADATA_SIZE, []byte{1, 2}))
+	require.Error(t, err)
+}
+
+func TestEncodeWithMetadata(t *testing.T) {
+	data := []byte("SomeInfo")
+	metadata := &Metadata{Filename: "a.txt", MimeType: "text/plain", Size: uint64(len(data))}
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	// the flag telling that there is an envelope needs versioned entrypoints
+	_, err := EncodeWithMetadata(data, metadata, recipients, random.New(), params, nil, false)
+	require.True(t, errors.Is(err, ErrUnversionedEntrypoints))
+	for _, info := range infoMap {
+		info.EntryPointLength = ENTRYPOINT_LENGTH_VERSIONED_32
+	}
+
+	purb, err := EncodeWithMetadata(data, metadata, recipients, random.New(), params, nil, false)
+	require.NoError(t, err)
+	for _, recipient := range recipients {
+		success, parsed, content, err := DecodeWithMetadata(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, metadata, parsed)
+		require.Equal(t, data, content)
+
+		// Decode drops the metadata
+		success, content, err = Decode(purb.ToBytes(), &recipient, params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, content)
+	}
+}
+
+func TestDecodeWithMetadataOfPlainPurb(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	// data which happens to look like an empty envelope is returned whole
+	for _, data := range [][]byte{{0, 0, 1, 2}, []byte("SomeInfo")} {
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		success, parsed, content, err := DecodeWithMetadata(purb.ToBytes(), &recipients[0], params, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Nil(t, parsed)
+		require.Equal(t, data, content)
+	}
+}
@@ -1,8 +1,12 @@
 package purbs
 
 import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
 	"gopkg.in/dedis/kyber.v2/util/random"
-	"math"
 )
 
 // Pads a message with random bytes as defined by Padmé.
@@ -18,6 +22,138 @@ func pad(msg []byte, other int) []byte {
 	return paddedMsg
 }
 
+// Rounds up the length of a PURB (or of its header) to one of a set of public lengths, so that the length leaks less
+// about the contents. PaddedLength must not return less than its argument, and must be non-decreasing
+type PaddingScheme interface {
+	PaddedLength(length int) int
+	String() string
+}
+
+// Padmé: the length is rounded so that its floating-point representation has O(log log L) bits of mantissa
+type PadmePadding struct{}
+
+// The length is rounded up to the next power of two
+type PowerOfTwoPadding struct{}
+
+// The length is rounded up to the next of the Buckets, sorted increasingly; above the last one, to a multiple of it
+type BucketsPadding struct {
+	Buckets []int
+}
+
+// The length is first raised to Minimum, then padded with Scheme (if not nil)
+type MinimumSizePadding struct {
+	Minimum int
+	Scheme  PaddingScheme
+}
+
+// The length is not changed
+type NoPadding struct{}
+
+func (PadmePadding) PaddedLength(length int) int {
+	if length <= 0 {
+		return length
+	}
+	return length + paddingLength(uint64(length))
+}
+
+func (PadmePadding) String() string {
+	return "padme"
+}
+
+func (PowerOfTwoPadding) PaddedLength(length int) int {
+	if length <= 0 {
+		return length
+	}
+	padded := 1
+	for padded < length {
+		padded <<= 1
+	}
+	return padded
+}
+
+func (PowerOfTwoPadding) String() string {
+	return "power-of-two"
+}
+
+func (scheme BucketsPadding) PaddedLength(length int) int {
+	if len(scheme.Buckets) == 0 {
+		return length
+	}
+	i := sort.SearchInts(scheme.Buckets, length)
+	if i < len(scheme.Buckets) {
+		return scheme.Buckets[i]
+	}
+	last := scheme.Buckets[len(scheme.Buckets)-1]
+	return (length + last - 1) / last * last
+}
+
+func (scheme BucketsPadding) String() string {
+	if len(scheme.Buckets) > 8 {
+		return fmt.Sprintf("buckets(%v from %v to %v)", len(scheme.Buckets), scheme.Buckets[0], scheme.Buckets[len(scheme.Buckets)-1])
+	}
+	return fmt.Sprintf("buckets%v", scheme.Buckets)
+}
+
+func (scheme MinimumSizePadding) PaddedLength(length int) int {
+	if length < scheme.Minimum {
+		length = scheme.Minimum
+	}
+	if scheme.Scheme == nil {
+		return length
+	}
+	return scheme.Scheme.PaddedLength(length)
+}
+
+func (scheme MinimumSizePadding) String() string {
+	if scheme.Scheme == nil {
+		return fmt.Sprintf("minimum(%v)", scheme.Minimum)
+	}
+	return fmt.Sprintf("minimum(%v, %v)", scheme.Minimum, scheme.Scheme)
+}
+
+func (NoPadding) PaddedLength(length int) int {
+	return length
+}
+
+func (NoPadding) String() string {
+	return "none"
+}
+
+// validatePaddingScheme checks the settings of the built-in schemes; other schemes are trusted
+func validatePaddingScheme(scheme PaddingScheme) error {
+	switch s := scheme.(type) {
+	case BucketsPadding:
+		if len(s.Buckets) == 0 {
+			return errors.New("no buckets")
+		}
+		for i, bucket := range s.Buckets {
+			if bucket <= 0 || (i > 0 && bucket <= s.Buckets[i-1]) {
+				return fmt.Errorf("buckets %v are not positive and strictly increasing", s.Buckets)
+			}
+		}
+	case MinimumSizePadding:
+		if s.Minimum < 0 {
+			return fmt.Errorf("negative minimum %v", s.Minimum)
+		}
+		if s.Scheme != nil {
+			return validatePaddingScheme(s.Scheme)
+		}
+	}
+	return nil
+}
+
+// Computes the length of a padded payload, for an encrypted payload of length encryptedLength placed after a header of
+// length headerLength. The total length (with the MAC) follows the padding scheme; as long as macOverlaps reports that
+// the MAC following the payload would overlap with something, one byte is added and the payload is padded again
+func paddedPayloadLength(encryptedLength, headerLength int, scheme PaddingScheme, macOverlaps func(macStart, macEnd int) bool) int {
+	other := headerLength + MAC_AUTHENTICATION_TAG_LENGTH
+	length := scheme.PaddedLength(encryptedLength+other) - other
+	for macOverlaps(headerLength+length, headerLength+length+MAC_AUTHENTICATION_TAG_LENGTH) {
+		length = scheme.PaddedLength(length+1+other) - other
+	}
+	return length
+}
+
 // UnPads a padded message
 func unPad(msg []byte, end int) []byte {
 	return msg[:end]
@@ -36,15 +172,15 @@ func paddingLength(msgLen uint64) int {
 }
 
 // Returns number of bytes at the end that are required to be zero in the binary
-// representation of message length l.
+// representation of message length l. Computed on integers, so that it is exact for any length
 func zeroBytesNeeded(l uint64) uint64 {
-	// the corner case of 1-byte message
-	if l == 1 {
+	// the corner case of 0 and 1-byte messages
+	if l <= 1 {
 		return uint64(0)
 	}
-	E := math.Floor(math.Log2(float64(l)))
-	S := math.Floor(math.Log2(E)) + 1
-	return uint64(E - S)
+	E := uint64(bits.Len64(l) - 1) // floor(log2(l))
+	S := uint64(bits.Len64(E))     // floor(log2(E)) + 1
+	return E - S
 }
 
 // Generates an array of random bytes of the required length
@@ -0,0 +1,68 @@
+package purbs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Padding buckets trained on a distribution of sizes (see leakage.TrainProfile), as stored in a JSON file
+type PaddingProfile struct {
+	Name        string  `json:"name"`         // usually, the dataset it was trained on
+	Objects     int     `json:"objects"`      // number of sizes it was trained on
+	MaxOverhead float64 `json:"max_overhead"` // largest relative overhead allowed on the training sizes
+	Buckets     []int   `json:"buckets"`      // padded lengths, in increasing order
+}
+
+// LoadPaddingProfile reads a padding profile from a JSON file
+func LoadPaddingProfile(path string) (*PaddingProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPaddingProfile(f)
+}
+
+// ReadPaddingProfile reads a padding profile in JSON, and checks its buckets
+func ReadPaddingProfile(r io.Reader) (*PaddingProfile, error) {
+	profile := new(PaddingProfile)
+	if err := json.NewDecoder(r).Decode(profile); err != nil {
+		return nil, err
+	}
+	if len(profile.Buckets) == 0 {
+		return nil, errors.New("padding profile without buckets")
+	}
+	if err := validatePaddingScheme(profile.Scheme()); err != nil {
+		return nil, fmt.Errorf("padding profile %v: %v", profile.Name, err)
+	}
+	return profile, nil
+}
+
+// Save writes the profile in JSON to a file
+func (profile *PaddingProfile) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := profile.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the profile in JSON
+func (profile *PaddingProfile) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(profile)
+}
+
+// Scheme returns the padding scheme of the profile, to be used as PaddingScheme in the public parameters. Lengths
+// above the last bucket are padded to a multiple of it, so the profile should cover the largest expected size
+func (profile *PaddingProfile) Scheme() PaddingScheme {
+	return BucketsPadding{Buckets: profile.Buckets}
+}
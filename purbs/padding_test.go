@@ -1,8 +1,12 @@
 package purbs
 
 import (
-	"github.com/stretchr/testify/require"
+	"bytes"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
 )
 
 func TestPad(t *testing.T) {
@@ -28,3 +32,94 @@ func TestBitsToZero(t *testing.T) {
 	require.Equal(t, 1, int(zeroBytesNeeded(9)))
 	require.Equal(t, 1, int(zeroBytesNeeded(10)))
 }
+
+func TestPaddingSchemes(t *testing.T) {
+	require.Equal(t, 72, PadmePadding{}.PaddedLength(67))
+	require.Equal(t, 128, PowerOfTwoPadding{}.PaddedLength(67))
+	require.Equal(t, 64, PowerOfTwoPadding{}.PaddedLength(64))
+	require.Equal(t, 67, NoPadding{}.PaddedLength(67))
+
+	buckets := BucketsPadding{Buckets: []int{128, 512, 2048}}
+	require.Equal(t, 128, buckets.PaddedLength(44))
+	require.Equal(t, 128, buckets.PaddedLength(128))
+	require.Equal(t, 512, buckets.PaddedLength(129))
+	require.Equal(t, 4096, buckets.PaddedLength(2049))
+
+	require.Equal(t, 1000, MinimumSizePadding{Minimum: 1000}.PaddedLength(67))
+	require.Equal(t, 1024, MinimumSizePadding{Minimum: 1000, Scheme: PowerOfTwoPadding{}}.PaddedLength(67))
+	require.Equal(t, 2048, MinimumSizePadding{Minimum: 1000, Scheme: PowerOfTwoPadding{}}.PaddedLength(1025))
+
+	require.Error(t, validatePaddingScheme(BucketsPadding{}))
+	require.Error(t, validatePaddingScheme(MinimumSizePadding{Minimum: 10, Scheme: BucketsPadding{Buckets: []int{2, 1}}}))
+	require.NoError(t, validatePaddingScheme(MinimumSizePadding{Minimum: 10, Scheme: buckets}))
+}
+
+func TestPaddedPayloadLength(t *testing.T) {
+	headerLength := 100
+	for _, scheme := range []PaddingScheme{PadmePadding{}, PowerOfTwoPadding{}, BucketsPadding{Buckets: []int{256, 1024}}, NoPadding{}} {
+		// the total length follows the scheme
+		length := paddedPayloadLength(50, headerLength, scheme, func(int, int) bool { return false })
+		total := headerLength + length + MAC_AUTHENTICATION_TAG_LENGTH
+		require.Equal(t, scheme.PaddedLength(total), total)
+
+		// and a MAC overlapping a forbidden region is moved past it, to another padded length
+		forbiddenEnd := total + 300
+		length = paddedPayloadLength(50, headerLength, scheme, func(macStart, macEnd int) bool {
+			return macStart < forbiddenEnd
+		})
+		total = headerLength + length + MAC_AUTHENTICATION_TAG_LENGTH
+		require.True(t, total-MAC_AUTHENTICATION_TAG_LENGTH >= forbiddenEnd)
+		require.Equal(t, scheme.PaddedLength(total), total)
+	}
+}
+
+func TestEncodeWithPaddingSchemes(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	for _, scheme := range []PaddingScheme{PowerOfTwoPadding{}, BucketsPadding{Buckets: []int{300, 1000}}, NoPadding{}} {
+		params := NewPublicFixedParameters(infoMap, false)
+		params.PaddingScheme = scheme
+		require.True(t, params.Validate().OK())
+
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		require.Equal(t, scheme.PaddedLength(len(purb.ToBytes())), len(purb.ToBytes()))
+
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
+
+func TestPaddingProfile(t *testing.T) {
+	profile := &PaddingProfile{Name: "test", Objects: 3, MaxOverhead: 0.1, Buckets: []int{110, 220, 1100}}
+	var buffer bytes.Buffer
+	require.NoError(t, profile.Write(&buffer))
+
+	loaded, err := ReadPaddingProfile(&buffer)
+	require.NoError(t, err)
+	require.Equal(t, profile, loaded)
+	require.Equal(t, 220, loaded.Scheme().PaddedLength(111))
+
+	_, err = ReadPaddingProfile(strings.NewReader(`{"name": "bad", "buckets": [220, 110]}`))
+	require.Error(t, err)
+	_, err = ReadPaddingProfile(strings.NewReader(`{"name": "empty"}`))
+	require.Error(t, err)
+}
+
+func TestPadmeExactForLargeLengths(t *testing.T) {
+	// float64 rounds 2^60-1 up to 2^60, whose logarithm is one too large
+	require.Equal(t, 59-6, int(zeroBytesNeeded(1<<60-1)))
+	require.Equal(t, 60-6, int(zeroBytesNeeded(1<<60)))
+
+	for _, length := range []int{1 << 33, 1<<40 + 12345, 1<<50 - 1} {
+		padded := PadmePadding{}.PaddedLength(length)
+		require.True(t, padded >= length)
+		require.True(t, float64(padded-length)/float64(length) <= 0.12)
+		require.Equal(t, padded, PadmePadding{}.PaddedLength(padded))
+	}
+}
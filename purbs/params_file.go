@@ -0,0 +1,227 @@
+package purbs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Version of the file format of the public parameters
+const PARAMETERS_FILE_FORMAT = 1
+
+// The public parameters as stored in a JSON file. Suites are keyed by the names recipients use as SuiteName
+type parametersFile struct {
+	Format                int                      `json:"format"`
+	Suites                map[string]suiteInfoFile `json:"suites"`
+	Placement             string                   `json:"placement"` // as given by EntrypointsPlacementMode.String
+	HashTableAttempts     int                      `json:"hash_table_linear_resolution_attempts,omitempty"`
+	CuckooMaxEntrypoints  int                      `json:"cuckoo_max_entrypoints,omitempty"`
+	Padding               *paddingSchemeFile       `json:"padding,omitempty"`
+	HeaderPadding         *paddingSchemeFile       `json:"header_padding,omitempty"`
+	HeaderCoverRecipients int                      `json:"header_cover_recipients,omitempty"`
+}
+
+type suiteInfoFile struct {
+	AllowedPositions  []int `json:"allowed_positions"`
+	CornerstoneLength int   `json:"cornerstone_length"`
+	EntryPointLength  int   `json:"entrypoint_length"`
+}
+
+// A built-in padding scheme; Type is what its String starts with
+type paddingSchemeFile struct {
+	Type    string             `json:"type"`
+	Buckets []int              `json:"buckets,omitempty"`
+	Minimum int                `json:"minimum,omitempty"`
+	Scheme  *paddingSchemeFile `json:"scheme,omitempty"`
+}
+
+// LoadPublicParameters reads public parameters from a JSON file
+func LoadPublicParameters(path string) (*PurbPublicFixedParameters, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPublicParameters(f)
+}
+
+// ReadPublicParameters reads public parameters in JSON. It only checks the file format: the parameters themselves
+// should be checked once with Validate, as when they are built in code
+func ReadPublicParameters(r io.Reader) (*PurbPublicFixedParameters, error) {
+	file := new(parametersFile)
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil {
+		return nil, err
+	}
+	if file.Format != PARAMETERS_FILE_FORMAT {
+		return nil, fmt.Errorf("unsupported parameters file format %v", file.Format)
+	}
+
+	params := &PurbPublicFixedParameters{
+		SuiteInfoMap: make(SuiteInfoMap),
+		HashTableCollisionLinearResolutionAttempts: file.HashTableAttempts,
+		CuckooMaxEntrypoints:                       file.CuckooMaxEntrypoints,
+		HeaderCoverRecipients:                      file.HeaderCoverRecipients,
+	}
+	for name, suite := range file.Suites {
+		params.SuiteInfoMap[name] = &SuiteInfo{
+			AllowedPositions:  suite.AllowedPositions,
+			CornerstoneLength: suite.CornerstoneLength,
+			EntryPointLength:  suite.EntryPointLength,
+		}
+	}
+
+	placement, err := parsePlacementMode(file.Placement)
+	if err != nil {
+		return nil, err
+	}
+	params.EntrypointsPlacement = placement
+
+	if params.PaddingScheme, err = file.Padding.scheme(); err != nil {
+		return nil, err
+	}
+	if params.HeaderPaddingScheme, err = file.HeaderPadding.scheme(); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Save writes the parameters in JSON to a file
+func (params *PurbPublicFixedParameters) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := params.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the parameters in JSON. Only the built-in padding schemes can be written
+func (params *PurbPublicFixedParameters) Write(w io.Writer) error {
+	file, err := params.toFile()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(file)
+}
+
+// Fingerprint returns a hash (SHA-256, in hex) of the canonical encoding of the parameters: services using the same
+// parameters have the same fingerprint, whatever the order or the layout of their files. A nil padding scheme has the
+// fingerprint of the scheme it stands for
+func (params *PurbPublicFixedParameters) Fingerprint() (string, error) {
+	file, err := params.toFile()
+	if err != nil {
+		return "", err
+	}
+	if file.Padding, err = paddingSchemeToFile(params.paddingScheme()); err != nil {
+		return "", err
+	}
+	if file.HeaderPadding, err = paddingSchemeToFile(params.headerPaddingScheme()); err != nil {
+		return "", err
+	}
+	// maps are encoded with sorted keys, and the structs in a fixed order, so the encoding is canonical
+	canonical, err := json.Marshal(file)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(canonical)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (params *PurbPublicFixedParameters) toFile() (*parametersFile, error) {
+	file := &parametersFile{
+		Format:                PARAMETERS_FILE_FORMAT,
+		Suites:                make(map[string]suiteInfoFile),
+		Placement:             params.EntrypointsPlacement.String(),
+		HashTableAttempts:     params.HashTableCollisionLinearResolutionAttempts,
+		CuckooMaxEntrypoints:  params.CuckooMaxEntrypoints,
+		HeaderCoverRecipients: params.HeaderCoverRecipients,
+	}
+	if _, err := parsePlacementMode(file.Placement); err != nil {
+		return nil, err
+	}
+	for name, info := range params.SuiteInfoMap {
+		file.Suites[name] = suiteInfoFile{
+			AllowedPositions:  info.AllowedPositions,
+			CornerstoneLength: info.CornerstoneLength,
+			EntryPointLength:  info.EntryPointLength,
+		}
+	}
+
+	var err error
+	if file.Padding, err = paddingSchemeToFile(params.PaddingScheme); err != nil {
+		return nil, err
+	}
+	if file.HeaderPadding, err = paddingSchemeToFile(params.HeaderPaddingScheme); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func parsePlacementMode(name string) (EntrypointsPlacementMode, error) {
+	for _, mode := range []EntrypointsPlacementMode{PlacementHashTable, PlacementSimplified, PlacementCuckoo} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown entrypoints placement mode %q", name)
+}
+
+// paddingSchemeToFile returns nil for a nil scheme, which keeps its default meaning
+func paddingSchemeToFile(scheme PaddingScheme) (*paddingSchemeFile, error) {
+	switch s := scheme.(type) {
+	case nil:
+		return nil, nil
+	case PadmePadding:
+		return &paddingSchemeFile{Type: "padme"}, nil
+	case PowerOfTwoPadding:
+		return &paddingSchemeFile{Type: "power-of-two"}, nil
+	case NoPadding:
+		return &paddingSchemeFile{Type: "none"}, nil
+	case BucketsPadding:
+		return &paddingSchemeFile{Type: "buckets", Buckets: s.Buckets}, nil
+	case MinimumSizePadding:
+		inner, err := paddingSchemeToFile(s.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		return &paddingSchemeFile{Type: "minimum", Minimum: s.Minimum, Scheme: inner}, nil
+	}
+	return nil, fmt.Errorf("padding scheme %v is not built-in, and cannot be written", scheme)
+}
+
+func (file *paddingSchemeFile) scheme() (PaddingScheme, error) {
+	if file == nil {
+		return nil, nil
+	}
+	switch file.Type {
+	case "padme":
+		return PadmePadding{}, nil
+	case "power-of-two":
+		return PowerOfTwoPadding{}, nil
+	case "none":
+		return NoPadding{}, nil
+	case "buckets":
+		if len(file.Buckets) == 0 {
+			return nil, errors.New("buckets padding without buckets")
+		}
+		return BucketsPadding{Buckets: file.Buckets}, nil
+	case "minimum":
+		inner, err := file.Scheme.scheme()
+		if err != nil {
+			return nil, err
+		}
+		return MinimumSizePadding{Minimum: file.Minimum, Scheme: inner}, nil
+	}
+	return nil, fmt.Errorf("unknown padding scheme %q", file.Type)
+}
@@ -0,0 +1,118 @@
+package purbs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+type customPadding struct{}
+
+func (customPadding) PaddedLength(length int) int { return length }
+func (customPadding) String() string              { return "custom" }
+
+func TestPublicParametersFile(t *testing.T) {
+	infoMap := getDummySuiteInfo(3)
+	for _, params := range []*PurbPublicFixedParameters{
+		NewPublicFixedParameters(infoMap, false),
+		NewPublicFixedParameters(infoMap, true),
+		NewCuckooPublicFixedParameters(infoMap, 10),
+		{
+			SuiteInfoMap:         infoMap,
+			EntrypointsPlacement: PlacementHashTable,
+			HashTableCollisionLinearResolutionAttempts: 3,
+			PaddingScheme:         MinimumSizePadding{Minimum: 512, Scheme: BucketsPadding{Buckets: []int{1024, 4096}}},
+			HeaderPaddingScheme:   PowerOfTwoPadding{},
+			HeaderCoverRecipients: 4,
+		},
+	} {
+		buffer := new(bytes.Buffer)
+		require.NoError(t, params.Write(buffer))
+		loaded, err := ReadPublicParameters(buffer)
+		require.NoError(t, err)
+		require.Equal(t, params, loaded)
+
+		fingerprint, err := params.Fingerprint()
+		require.NoError(t, err)
+		loadedFingerprint, err := loaded.Fingerprint()
+		require.NoError(t, err)
+		require.Equal(t, fingerprint, loadedFingerprint)
+	}
+}
+
+func TestPublicParametersFingerprint(t *testing.T) {
+	params := NewPublicFixedParameters(getDummySuiteInfo(2), false)
+	fingerprint, err := params.Fingerprint()
+	require.NoError(t, err)
+	require.Len(t, fingerprint, 64)
+
+	for _, change := range []func(*PurbPublicFixedParameters){
+		func(p *PurbPublicFixedParameters) { p.EntrypointsPlacement = PlacementSimplified },
+		func(p *PurbPublicFixedParameters) { p.PaddingScheme = PowerOfTwoPadding{} },
+		func(p *PurbPublicFixedParameters) { p.HeaderPaddingScheme = PadmePadding{} },
+		func(p *PurbPublicFixedParameters) {
+			for _, info := range p.SuiteInfoMap {
+				info.AllowedPositions = append([]int{}, info.AllowedPositions...)
+				info.AllowedPositions[0]++
+				break
+			}
+		},
+	} {
+		changed := NewPublicFixedParameters(getDummySuiteInfo(2), false)
+		change(changed)
+		changedFingerprint, err := changed.Fingerprint()
+		require.NoError(t, err)
+		require.NotEqual(t, fingerprint, changedFingerprint)
+	}
+
+	// the defaults, explicit or not, are the same parameters
+	explicit := NewPublicFixedParameters(getDummySuiteInfo(2), false)
+	explicit.PaddingScheme = PadmePadding{}
+	explicit.HeaderPaddingScheme = NoPadding{}
+	explicitFingerprint, err := explicit.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, explicitFingerprint)
+
+	params.PaddingScheme = customPadding{}
+	_, err = params.Fingerprint()
+	require.Error(t, err)
+}
+
+func TestReadInvalidPublicParameters(t *testing.T) {
+	for _, invalid := range []string{
+		`{"format": 2, "suites": {}, "placement": "simplified"}`,
+		`{"format": 1, "suites": {}, "placement": "spiral"}`,
+		`{"format": 1, "suites": {}, "placement": "simplified", "padding": {"type": "fibonacci"}}`,
+		`{"format": 1, "suites": {}, "placement": "simplified", "padding": {"type": "buckets"}}`,
+		`{"format": 1, "suites": {}, "placement": "simplified", "colour": "blue"}`,
+	} {
+		_, err := ReadPublicParameters(strings.NewReader(invalid))
+		require.Error(t, err)
+	}
+}
+
+func TestEncodeWithLoadedParameters(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+
+	buffer := new(bytes.Buffer)
+	require.NoError(t, params.Write(buffer))
+	loaded, err := ReadPublicParameters(buffer)
+	require.NoError(t, err)
+	require.True(t, loaded.Validate().OK())
+
+	// PURBs encoded with the parameters decode with the loaded ones
+	purb, err := Encode(data, recipients, random.New(), params, false)
+	require.NoError(t, err)
+	for _, recipient := range recipients {
+		success, message, err := Decode(purb.ToBytes(), &recipient, loaded, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+}
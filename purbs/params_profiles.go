@@ -0,0 +1,106 @@
+package purbs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Names of the suites in the built-in profiles. They do not depend on how a library names its suites (e.g., kyber's
+// String()), so PURBs from different implementations interoperate. Only SUITE_CURVE25519 has a built-in
+// implementation, the others are registered by the applications which use them (see RegisterSuite)
+const (
+	SUITE_CURVE25519 = "curve25519" // Curve25519 with Elligator 2, 32-byte cornerstones
+	SUITE_CURVE1174  = "curve1174"  // Curve1174 with Elligator 1, 32-byte cornerstones
+	SUITE_CURVE448   = "curve448"   // Curve448 with Elligator 2, 56-byte cornerstones
+)
+
+// Names of the built-in profiles
+const (
+	PROFILE_CURVE25519_ONLY_V1 = "curve25519-only-v1"
+	PROFILE_MULTI_SUITE_V1     = "multi-suite-v1"
+)
+
+// A named set of public parameters, shipped with the library. A profile is frozen once released: changing anything
+// in it would make the PURBs of older encoders undecodable, so changes go in a new profile with a new name. The
+// tests check each released profile against its fingerprint. An unreleased profile can still change, and has no
+// fingerprint
+type parametersProfile struct {
+	description string
+	released    bool
+	fingerprint string // Fingerprint() of the parameters, once released
+	parameters  func() *PurbPublicFixedParameters
+}
+
+// The AllowedPositions were computed once with GenerateSuiteInfoMap, and are now part of the profiles
+var parametersProfiles = map[string]*parametersProfile{
+	PROFILE_CURVE25519_ONLY_V1: {
+		description: "curve25519 only, versioned entrypoints in hash tables, Padmé",
+		released:    true,
+		fingerprint: "ea6809bd8690c5494c1ad7a4fc5f8f27225aab3a6d4f05d6509fa46c3b539f18",
+		parameters: func() *PurbPublicFixedParameters {
+			return &PurbPublicFixedParameters{
+				SuiteInfoMap: SuiteInfoMap{
+					SUITE_CURVE25519: {AllowedPositions: []int{12}, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+				},
+				EntrypointsPlacement:                       PlacementHashTable,
+				HashTableCollisionLinearResolutionAttempts: 3,
+				PaddingScheme:                              PadmePadding{},
+			}
+		},
+	},
+	// Unreleased until curve1174 and curve448 have implementations to test it with: its AllowedPositions may change
+	PROFILE_MULTI_SUITE_V1: {
+		description: "curve25519, curve1174 and curve448, versioned entrypoints in hash tables, Padmé",
+		parameters: func() *PurbPublicFixedParameters {
+			return &PurbPublicFixedParameters{
+				SuiteInfoMap: SuiteInfoMap{
+					SUITE_CURVE25519: {AllowedPositions: []int{12}, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+					SUITE_CURVE448:   {AllowedPositions: []int{44}, CornerstoneLength: 56, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+					SUITE_CURVE1174:  {AllowedPositions: []int{12, 44, 100}, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+				},
+				EntrypointsPlacement:                       PlacementHashTable,
+				HashTableCollisionLinearResolutionAttempts: 3,
+				PaddingScheme:                              PadmePadding{},
+			}
+		},
+	},
+}
+
+// ProfileNames returns the names of the built-in profiles, sorted
+func ProfileNames() []string {
+	names := make([]string, 0, len(parametersProfiles))
+	for name := range parametersProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileReleased tells whether a built-in profile is released, and so frozen. PURBs encoded with an unreleased
+// profile may not decode with later versions of the library
+func ProfileReleased(name string) (bool, error) {
+	profile, ok := parametersProfiles[name]
+	if !ok {
+		return false, fmt.Errorf("unknown profile %q, the profiles are %v", name, ProfileNames())
+	}
+	return profile.released, nil
+}
+
+// ProfileParameters returns the public parameters of a built-in profile. They are a fresh copy, which the caller can
+// change without changing the profile
+func ProfileParameters(name string) (*PurbPublicFixedParameters, error) {
+	profile, ok := parametersProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, the profiles are %v", name, ProfileNames())
+	}
+	return profile.parameters(), nil
+}
+
+// ProfileDescription returns a one-line description of a built-in profile
+func ProfileDescription(name string) (string, error) {
+	profile, ok := parametersProfiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown profile %q, the profiles are %v", name, ProfileNames())
+	}
+	return profile.description, nil
+}
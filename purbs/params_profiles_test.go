@@ -0,0 +1,84 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/group/curve25519"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestProfilesAreFrozen(t *testing.T) {
+	require.Equal(t, []string{PROFILE_CURVE25519_ONLY_V1, PROFILE_MULTI_SUITE_V1}, ProfileNames())
+	for _, name := range ProfileNames() {
+		params, err := ProfileParameters(name)
+		require.NoError(t, err)
+		require.True(t, params.Validate().OK(), name)
+
+		// a released profile never changes
+		fingerprint, err := params.Fingerprint()
+		require.NoError(t, err)
+		released, err := ProfileReleased(name)
+		require.NoError(t, err)
+		if released {
+			require.Equal(t, parametersProfiles[name].fingerprint, fingerprint, name)
+		} else {
+			require.Empty(t, parametersProfiles[name].fingerprint, name)
+		}
+
+		// and callers only get copies
+		for _, info := range params.SuiteInfoMap {
+			info.AllowedPositions[0]++
+		}
+		params.PaddingScheme = NoPadding{}
+		fresh, err := ProfileParameters(name)
+		require.NoError(t, err)
+		freshFingerprint, err := fresh.Fingerprint()
+		require.NoError(t, err)
+		require.Equal(t, fingerprint, freshFingerprint)
+
+		_, err = ProfileDescription(name)
+		require.NoError(t, err)
+	}
+
+	_, err := ProfileParameters("curve25519-only-v0")
+	require.Error(t, err)
+	_, err = ProfileReleased("curve25519-only-v0")
+	require.Error(t, err)
+
+	// the suites of multi-suite-v1 have no implementation yet
+	released, err := ProfileReleased(PROFILE_MULTI_SUITE_V1)
+	require.NoError(t, err)
+	require.False(t, released)
+
+	// parameters built from the same suites, with the default padding, are the profile
+	params, err := ProfileParameters(PROFILE_CURVE25519_ONLY_V1)
+	require.NoError(t, err)
+	fingerprint, err := NewPublicFixedParameters(params.SuiteInfoMap, false).Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, parametersProfiles[PROFILE_CURVE25519_ONLY_V1].fingerprint, fingerprint)
+}
+
+func TestEncodeWithProfile(t *testing.T) {
+	data := []byte("SomeInfo")
+	suite := curve25519.NewBlakeSHA256Curve25519(true)
+	recipients := make([]Recipient, 3)
+	for i := range recipients {
+		pair := key.NewHidingKeyPair(suite)
+		recipients[i] = Recipient{SuiteName: SUITE_CURVE25519, Suite: suite, PublicKey: pair.Public, PrivateKey: pair.Private}
+	}
+
+	for _, name := range ProfileNames() {
+		params, err := ProfileParameters(name)
+		require.NoError(t, err)
+		purb, err := Encode(data, recipients, random.New(), params, false)
+		require.NoError(t, err)
+		for _, recipient := range recipients {
+			success, message, err := Decode(purb.ToBytes(), &recipient, params, false)
+			require.NoError(t, err)
+			require.True(t, success)
+			require.Equal(t, data, message)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package purbs
 
 import (
 	"github.com/stretchr/testify/require"
+	kyber "gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/group/curve25519"
 	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/kyber.v2/util/random"
@@ -17,7 +18,7 @@ func TestGenCornerstones(t *testing.T) {
 		Nonce:      nil,
 		Header:     nil,
 		Payload:    nil,
-		SessionKey: nil,
+		sessionKey: nil,
 
 		IsVerbose:        true,
 		Recipients:       nil,
@@ -29,12 +30,84 @@ func TestGenCornerstones(t *testing.T) {
 
 	purb.Header = newEmptyHeader()
 
-	purb.createCornerstones()
+	require.NoError(t, purb.createCornerstones())
 
 	for _, stone := range purb.Header.Cornerstones {
-		require.Equal(t, stone.KeyPair.Hiding.HideLen(), si[stone.SuiteName].CornerstoneLength)
-		require.NotEqual(t, stone.KeyPair.Private, nil)
-		require.NotEqual(t, stone.KeyPair.Public, nil)
+		require.Equal(t, stone.keyPair.Hiding.HideLen(), si[stone.SuiteName].CornerstoneLength)
+		require.NotEqual(t, stone.keyPair.Private, nil)
+		require.NotEqual(t, stone.keyPair.Public, nil)
+	}
+}
+
+func TestCornerstoneTooShort(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(1, 1, infoMap)
+	for _, info := range infoMap {
+		info.CornerstoneLength = 16
+	}
+
+	// the hidden public keys do not fit: an error, not an exit
+	_, err := Encode([]byte("SomeInfo"), recipients, random.New(), NewPublicFixedParameters(infoMap, false), false)
+	require.Error(t, err)
+}
+
+func TestWipeSecrets(t *testing.T) {
+	infoMap := getDummySuiteInfo(2)
+	purb := &Purb{
+		IsVerbose:        false,
+		Recipients:       createRecipients(2, 2, infoMap),
+		Stream:           random.New(),
+		PublicParameters: NewPublicFixedParameters(infoMap, false),
+	}
+	purb.sessionKey = purb.randomBytes(SYMMETRIC_KEY_LENGTH)
+	sessionKey := purb.sessionKey
+	require.NoError(t, purb.CreateHeader())
+
+	sharedSecrets := make([][]byte, 0)
+	for _, entrypoints := range purb.Header.EntryPoints {
+		for _, entrypoint := range entrypoints {
+			sharedSecrets = append(sharedSecrets, entrypoint.sharedSecret)
+		}
+	}
+	// createEntryPoints already zeroed the cornerstones' private keys, give them live ones to wipe
+	for _, cornerstone := range purb.Header.Cornerstones {
+		cornerstone.keyPair.Private = cornerstone.keyPair.Private.Clone().Pick(purb.Stream)
+		require.False(t, cornerstone.keyPair.Private.Equal(purb.Recipients[0].Suite.Scalar().Zero()))
+	}
+	purb.wipeSecrets()
+
+	require.Equal(t, make([]byte, SYMMETRIC_KEY_LENGTH), sessionKey)
+	for _, sharedSecret := range sharedSecrets {
+		require.Equal(t, make([]byte, len(sharedSecret)), sharedSecret)
+	}
+	for _, cornerstone := range purb.Header.Cornerstones {
+		require.True(t, cornerstone.keyPair.Private.Equal(purb.Recipients[0].Suite.Scalar().Zero()))
+	}
+}
+
+func TestEncodeKeepsRecipientKeys(t *testing.T) {
+	data := []byte("SomeInfo")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(2, 1, infoMap)
+	publicFixedParams := NewPublicFixedParameters(infoMap, false)
+
+	publicKeys := make([]string, 0)
+	for _, recipient := range recipients {
+		publicKeys = append(publicKeys, recipient.PublicKey.String())
+	}
+
+	// encoding twice for the same recipients must work, and must not modify their keys
+	for i := 0; i < 2; i++ {
+		purb, err := Encode(data, recipients, random.New(), publicFixedParams, false)
+		require.NoError(t, err)
+
+		success, message, err := Decode(purb.ToBytes(), &recipients[1], publicFixedParams, false)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, data, message)
+	}
+	for i, recipient := range recipients {
+		require.Equal(t, publicKeys[i], recipient.PublicKey.String())
 	}
 }
 
@@ -244,3 +317,64 @@ func createRecipients(n int, numberOfSuites int, si SuiteInfoMap) []Recipient {
 	}
 	return decs
 }
+
+func TestParallelEncodingIsDeterministic(t *testing.T) {
+	infoMap := getDummySuiteInfo(3)
+	purb := &Purb{
+		Recipients:       createRecipients(20, 3, infoMap),
+		PublicParameters: NewPublicFixedParameters(infoMap, false),
+		Payload:          []byte("01234567"),
+	}
+	purb.Nonce = make([]byte, NONCE_LENGTH)
+	purb.sessionKey = make([]byte, SYMMETRIC_KEY_LENGTH)
+	purb.Stream = random.New()
+	purb.Header = newEmptyHeader()
+	require.NoError(t, purb.createCornerstones())
+
+	privateKeys := make(map[string]kyber.Scalar)
+	for suiteName, cornerstone := range purb.Header.Cornerstones {
+		privateKeys[suiteName] = cornerstone.keyPair.Private.Clone()
+	}
+
+	// same keys and same randomness stream, sequential vs parallel: the outputs must be identical
+	blobs := make([][]byte, 0)
+	for _, workers := range []int{1, 8} {
+		for suiteName, cornerstone := range purb.Header.Cornerstones {
+			cornerstone.keyPair.Private = privateKeys[suiteName].Clone()
+		}
+		purb.Header.EntryPoints = make(map[string][]*EntryPoint)
+		purb.Header.Layout = NewRegionReservationStruct()
+		purb.Options = &EncoderOptions{Workers: workers}
+		purb.Stream = curve25519.NewBlakeSHA256Curve25519(true).XOF([]byte("seed"))
+
+		purb.createEntryPoints()
+		require.NoError(t, purb.placeCornerstones())
+		purb.placeEntrypoints()
+		require.NoError(t, purb.placePayloadAndCornerstones(purb.Stream))
+		blobs = append(blobs, purb.ToBytes())
+	}
+	require.Equal(t, blobs[0], blobs[1])
+}
+
+func benchmarkEncodeManyRecipients(b *testing.B, workers int) {
+	data := []byte("01234567")
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(500, 1, infoMap)
+	params := NewPublicFixedParameters(infoMap, false)
+	options := &EncoderOptions{Workers: workers}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeWithOptions(data, recipients, random.New(), params, options, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeManyRecipients(b *testing.B) {
+	benchmarkEncodeManyRecipients(b, 1)
+}
+
+func BenchmarkEncodeManyRecipientsParallel(b *testing.B) {
+	benchmarkEncodeManyRecipients(b, 8)
+}
@@ -8,9 +8,11 @@ import (
 
 // RangeReservationLayout is used to represent a []byte array with (potentially overlapping) range=byteRangeForAllowedPositionIndex reservations
 // Expose "Reset()", "Reserve(range)", and "ScanFree"
+// The reservations are kept in an interval tree (a treap sorted by startPos, where each node knows the largest endPos
+// below it), so that Reserve and IsFree are O(log n). The tree is never modified in place, so Clone is O(1)
 type RegionReservationStruct struct {
-	regions          []*Region // important, those ranges are *always* sorted by startPos
-	coalescedRegions []*Region // same as "regions" but coalesced, e.g., [10-150],[100-1000] becomes [10-1000]
+	root *regionNode // nil when the layout is empty
+	seq  uint64      // number of regions ever added, orders regions with the same startPos and seeds the priorities
 }
 
 // NewSkipLayout creates a new RangeReservationLayout
@@ -20,67 +22,37 @@ func NewRegionReservationStruct() *RegionReservationStruct {
 	return layout
 }
 
-// Deep-clone structure
+// Clone returns an independent copy of the structure. Both share the tree, which is copied on write
 func (r *RegionReservationStruct) Clone() *RegionReservationStruct {
-
-	r2 := NewRegionReservationStruct()
-
-	r2.regions = make([]*Region, 0)
-	for _, region := range r.regions {
-		r2.regions = append(r2.regions, &Region{
-			startPos: region.startPos,
-			endPos:   region.endPos,
-			label:    region.label,
-		})
-	}
-
-	r2.coalescedRegions = make([]*Region, 0)
-	for _, region := range r.coalescedRegions {
-		r2.coalescedRegions = append(r2.coalescedRegions, &Region{
-			startPos: region.startPos,
-			endPos:   region.endPos,
-			label:    region.label,
-		})
-	}
-
-	return r2
+	r2 := *r
+	return &r2
 }
 
 // Reset marks all regions as free
 func (r *RegionReservationStruct) Reset() {
-	r.regions = make([]*Region, 0)
-	r.coalescedRegions = make([]*Region, 0)
+	r.root = nil
+	r.seq = 0
 }
 
-// Adds a byteRangeForAllowedPositionIndex, then performs insertion sort on the regions
-func (r *RegionReservationStruct) addThenSort(startPos int, endPos int, label string) {
-	newRegion := &Region{
-		startPos: startPos,
-		endPos:   endPos,
-		label:    label,
+// Adds a byteRangeForAllowedPositionIndex to the tree
+func (r *RegionReservationStruct) add(startPos int, endPos int, label string) {
+	r.seq++
+	node := &regionNode{
+		region: Region{
+			startPos: startPos,
+			endPos:   endPos,
+			label:    label,
+		},
+		seq:      r.seq,
+		priority: treapPriority(r.seq),
+		maxEnd:   endPos,
 	}
-	r.regions = append(r.regions, newRegion)
-	insertionSort(r.regions)
-	r.coalescedRegions = coalesceRegions(r.regions)
+	r.root = r.root.insert(node)
 }
 
 // Returns true iff the requested byteRangeForAllowedPositionIndex is free
 func (r *RegionReservationStruct) IsFree(startPos int, endPos int) bool {
-
-	// if the layout is empty, everything is free!
-	if len(r.regions) == 0 {
-		return true
-	}
-
-	// check if there is a conflict with a coalesced byteRangeForAllowedPositionIndex
-	for _, region := range r.coalescedRegions {
-		if startPos >= region.endPos || endPos <= region.startPos {
-			// does not collide
-		} else {
-			return false
-		}
-	}
-	return true
+	return r.root.findOverlap(startPos, endPos) == nil
 }
 
 // Attempt to reserve a specific extent in the layout.
@@ -90,19 +62,13 @@ func (r *RegionReservationStruct) IsFree(startPos int, endPos int) bool {
 // Returns true if requested byteRangeForAllowedPositionIndex was reserved, false if not.
 func (r *RegionReservationStruct) Reserve(startPos int, endPos int, requireFree bool, label string) bool {
 
-	// easiest case: if we don't care about the byteRangeForAllowedPositionIndex being free, just add the byteRangeForAllowedPositionIndex
-	if !requireFree {
-		r.addThenSort(startPos, endPos, label)
-		return true
-	}
-
-	// other case, we need to check whether the interval is free
-	if !r.IsFree(startPos, endPos) {
+	// we need to check whether the interval is free
+	if requireFree && !r.IsFree(startPos, endPos) {
 		// we couldn't reserve
 		return false
 	}
 
-	r.addThenSort(startPos, endPos, label)
+	r.add(startPos, endPos, label)
 	return true
 }
 
@@ -110,25 +76,23 @@ func (r *RegionReservationStruct) Reserve(startPos int, endPos int, requireFree
 // up to a given maximum byte offset.
 func (r *RegionReservationStruct) ScanFreeRegions(f func(int, int), maxByteOffset int) {
 
-	if len(r.regions) == 0 {
+	if r.root == nil {
 		f(0, maxByteOffset)
 		return
 	}
 
-	// coalesce all regions into ranges
-	coalescedRegions := r.coalescedRegions
-
-	// we have a coalesced byteRangeForAllowedPositionIndex, just loop through and call the appropriate function
+	// the regions come sorted by startPos; currentOffset is the end of the reserved regions seen so far, which
+	// coalesces them on the fly
 	currentOffset := 0
-	for _, region := range coalescedRegions {
-
+	r.root.walk(func(region *Region) {
 		if region.startPos > currentOffset {
-			// we scan the free byteRangeForAllowedPositionIndex between 0 and this range
+			// we scan the free byteRangeForAllowedPositionIndex between the previous regions and this one
 			f(currentOffset, region.startPos)
 		}
-
-		currentOffset = region.endPos
-	}
+		if region.endPos > currentOffset {
+			currentOffset = region.endPos
+		}
+	})
 
 	// do not forget the byteRangeForAllowedPositionIndex between the last range (if any) and the maxByteOffset (free by definition)
 	if currentOffset < maxByteOffset {
@@ -136,12 +100,76 @@ func (r *RegionReservationStruct) ScanFreeRegions(f func(int, int), maxByteOffse
 	}
 }
 
+// Release marks [startPos, endPos[ as free. The reservations overlapping it are cut, keeping their labels on the parts
+// outside of it
+func (r *RegionReservationStruct) Release(startPos int, endPos int) {
+	overlapping := make([]*regionNode, 0)
+	r.root.collectOverlaps(startPos, endPos, func(n *regionNode) {
+		overlapping = append(overlapping, n)
+	})
+
+	for _, n := range overlapping {
+		r.root = r.root.remove(n)
+		if n.region.startPos < startPos {
+			r.add(n.region.startPos, startPos, n.region.label)
+		}
+		if n.region.endPos > endPos {
+			r.add(endPos, n.region.endPos, n.region.label)
+		}
+	}
+}
+
+// RegionsAt returns the labels of the reservations containing the byte at offset, sorted by start position
+func (r *RegionReservationStruct) RegionsAt(offset int) []string {
+	labels := make([]string, 0)
+	r.root.collectOverlaps(offset, offset+1, func(n *regionNode) {
+		labels = append(labels, n.region.label)
+	})
+	return labels
+}
+
+// Regions returns the reservations, sorted by start position. They can overlap
+func (r *RegionReservationStruct) Regions() []Region {
+	regions := make([]Region, 0)
+	r.root.walk(func(region *Region) {
+		regions = append(regions, *region)
+	})
+	return regions
+}
+
+// Iterate calls f, in order, on every reservation and on every free region up to maxByteOffset; free regions have an
+// empty label and free set to true. Reservations can overlap, a free region is reported right before the reservation
+// ending it. Iteration stops when f returns false
+func (r *RegionReservationStruct) Iterate(f func(region Region, free bool) bool, maxByteOffset int) {
+	currentOffset := 0
+	stopped := false
+	r.root.walk(func(region *Region) {
+		if stopped {
+			return
+		}
+		if region.startPos > currentOffset && !f(Region{startPos: currentOffset, endPos: region.startPos}, true) {
+			stopped = true
+			return
+		}
+		if region.endPos > currentOffset {
+			currentOffset = region.endPos
+		}
+		stopped = !f(*region, false)
+	})
+
+	if !stopped && currentOffset < maxByteOffset {
+		f(Region{startPos: currentOffset, endPos: maxByteOffset}, true)
+	}
+}
+
 // ToString // thank you golang for forcing me to comment on "ToString()"
 func (r *RegionReservationStruct) ToString() string {
 	s := ""
-	for k, region := range r.regions {
+	k := 0
+	r.root.walk(func(region *Region) {
 		s += fmt.Sprintf("%v: %v\n", k, region.ToString())
-	}
+		k++
+	})
 	return s
 }
 
@@ -152,6 +180,21 @@ type Region struct {
 	label    string
 }
 
+// Start returns the first byte of the region
+func (r Region) Start() int {
+	return r.startPos
+}
+
+// End returns the byte after the region
+func (r Region) End() int {
+	return r.endPos
+}
+
+// Label returns the label given when reserving the region
+func (r Region) Label() string {
+	return r.label
+}
+
 // ToString // thank you golang for forcing me to comment on "ToString()"
 func (r *Region) ToString() string {
 	s := ""
@@ -192,65 +235,159 @@ func (r *Region) ComputeOverlap(otherRegion *Region) *Region {
 	return newRegion
 }
 
-func coalesceRegions(regions []*Region) []*Region {
-	coalescedRegions := make([]*Region, 0)
+// A node of the interval tree. Nodes are immutable once they are in a tree
+type regionNode struct {
+	region      Region
+	seq         uint64 // with region.startPos, the key of the node
+	priority    uint64 // heap order of the treap, which keeps it balanced
+	maxEnd      int    // largest endPos in this subtree
+	left, right *regionNode
+}
 
-	for _, region := range regions {
-		hasCoalesced := false
+// treapPriority spreads the sequence numbers (splitmix64), giving pseudo-random but reproducible priorities
+func treapPriority(seq uint64) uint64 {
+	z := seq + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
 
-		for i := range coalescedRegions {
-			if region.DoesOverlapWith(coalescedRegions[i]) {
-				// replace the byteRangeForAllowedPositionIndex already in coalescedRegions with the new merged range
-				coalescedRegions[i] = region.ComputeOverlap(coalescedRegions[i])
-				hasCoalesced = true
-			}
-		}
+func (n *regionNode) less(other *regionNode) bool {
+	if n.region.startPos != other.region.startPos {
+		return n.region.startPos < other.region.startPos
+	}
+	return n.seq < other.seq
+}
 
-		// we did not coalesce, just add
-		if !hasCoalesced {
-			coalescedRegions = append(coalescedRegions, region)
-		} else {
-			// we did coalesce, *but* we might have missed more coalescing (cascade), redo 1 pass
-			coalescedRegions = onePassCoalesceRegions(coalescedRegions)
-		}
+// copy returns a shallow copy of the node, to be modified then put in a new version of the tree
+func (n *regionNode) copy() *regionNode {
+	c := *n
+	return &c
+}
+
+// update recomputes maxEnd from the children
+func (n *regionNode) update() {
+	n.maxEnd = n.region.endPos
+	if n.left != nil && n.left.maxEnd > n.maxEnd {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd > n.maxEnd {
+		n.maxEnd = n.right.maxEnd
+	}
+}
+
+// insert returns a new tree with the fresh node m added; n is left untouched
+func (n *regionNode) insert(m *regionNode) *regionNode {
+	if n == nil {
+		return m
+	}
+	if m.priority > n.priority {
+		m.left, m.right = n.split(m)
+		m.update()
+		return m
+	}
+	c := n.copy()
+	if m.less(n) {
+		c.left = n.left.insert(m)
+	} else {
+		c.right = n.right.insert(m)
+	}
+	c.update()
+	return c
+}
+
+// split returns two new trees, with the nodes before key and the others; n is left untouched
+func (n *regionNode) split(key *regionNode) (*regionNode, *regionNode) {
+	if n == nil {
+		return nil, nil
+	}
+	c := n.copy()
+	if n.less(key) {
+		var right *regionNode
+		c.right, right = n.right.split(key)
+		c.update()
+		return c, right
+	}
+	var left *regionNode
+	left, c.left = n.left.split(key)
+	c.update()
+	return left, c
+}
+
+// remove returns a new tree without the node target (found by its key); n is left untouched
+func (n *regionNode) remove(target *regionNode) *regionNode {
+	if n == nil {
+		return nil
 	}
-	return coalescedRegions
+	if n.seq == target.seq {
+		return mergeRegionNodes(n.left, n.right)
+	}
+	c := n.copy()
+	if target.less(n) {
+		c.left = n.left.remove(target)
+	} else {
+		c.right = n.right.remove(target)
+	}
+	c.update()
+	return c
 }
 
-func onePassCoalesceRegions(regions []*Region) []*Region {
+// mergeRegionNodes returns a new tree with the nodes of a and b, all nodes of a coming before those of b
+func mergeRegionNodes(a, b *regionNode) *regionNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		c := a.copy()
+		c.right = mergeRegionNodes(a.right, b)
+		c.update()
+		return c
+	}
+	c := b.copy()
+	c.left = mergeRegionNodes(a, b.left)
+	c.update()
+	return c
+}
 
-	outputRegions := make([]*Region, 0)
+// collectOverlaps calls f, in order, on every node whose region overlaps [startPos, endPos[
+func (n *regionNode) collectOverlaps(startPos, endPos int, f func(*regionNode)) {
+	if n == nil || n.maxEnd <= startPos {
+		return
+	}
+	n.left.collectOverlaps(startPos, endPos, f)
+	if startPos < n.region.endPos && endPos > n.region.startPos {
+		f(n)
+	}
+	if n.region.startPos < endPos {
+		n.right.collectOverlaps(startPos, endPos, f)
+	}
+}
 
-	for _, region := range regions {
-		// cornercase, the first block never coalesces
-		if len(outputRegions) == 0 {
-			outputRegions = append(outputRegions, region)
-			continue
+// findOverlap returns a region overlapping [startPos, endPos[, or nil. If the left subtree reaches beyond startPos but
+// has no overlapping region, then one of its regions starts after endPos, and so do all regions on the right
+func (n *regionNode) findOverlap(startPos, endPos int) *Region {
+	for n != nil {
+		if startPos < n.region.endPos && endPos > n.region.startPos {
+			return &n.region
 		}
-
-		// if this byteRangeForAllowedPositionIndex overlap with the previously registered byteRangeForAllowedPositionIndex, replace it with the combination
-		lastElem := len(outputRegions) - 1
-		if region.DoesOverlapWith(outputRegions[lastElem]) {
-			// replace the byteRangeForAllowedPositionIndex already in coalescedRegions with the new merged range
-			outputRegions[lastElem] = region.ComputeOverlap(outputRegions[lastElem])
+		if n.left != nil && n.left.maxEnd > startPos {
+			n = n.left
 		} else {
-			// otherwise, we cannot coalesce, just add
-			outputRegions = append(outputRegions, region)
+			n = n.right
 		}
 	}
-
-	return outputRegions
+	return nil
 }
 
-func insertionSort(items []*Region) {
-	var n = len(items)
-	for i := 1; i < n; i++ {
-		j := i
-		for j > 0 {
-			if items[j-1].startPos > items[j].startPos {
-				items[j-1], items[j] = items[j], items[j-1]
-			}
-			j = j - 1
-		}
+// walk calls f on every region, sorted by startPos
+func (n *regionNode) walk(f func(*Region)) {
+	if n == nil {
+		return
 	}
+	n.left.walk(f)
+	f(&n.region)
+	n.right.walk(f)
 }
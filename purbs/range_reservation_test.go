@@ -1,28 +1,102 @@
 package purbs
 
 import (
+	"math/rand"
 	"strconv"
+	"strings"
 	"testing"
 )
 
-func TestInsertionSort(t *testing.T) {
+func TestRangeReservationOrder(t *testing.T) {
 	input := []int{503, -319, 245, -537, -167, -804, 469, -457, 143, 184, 376, 825, 11, -309, -144, 152, -493, 684, 165, 29}
 	output := []int{-804, -537, -493, -457, -319, -309, -167, -144, 11, 29, 143, 152, 165, 184, 245, 376, 469, 503, 684, 825}
 
-	regionsInputs := make([]*Region, 0)
-
+	layout := NewRegionReservationStruct()
 	for _, i := range input {
-		regionsInputs = append(regionsInputs, &Region{
-			startPos: i,
-		})
+		layout.Reserve(i, i+1, false, "")
+	}
+
+	k := 0
+	layout.root.walk(func(region *Region) {
+		if output[k] != region.startPos {
+			t.Error("Position", k, "should have value", output[k], "has value", region.startPos)
+		}
+		k++
+	})
+	if k != len(output) {
+		t.Error("Layout should hold", len(output), "regions, holds", k)
 	}
+}
+
+func TestRangeReservationRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	layout := NewRegionReservationStruct()
+	reserved := make([]bool, 1000)
+
+	for i := 0; i < 2000; i++ {
+		start := rng.Intn(990)
+		end := start + 1 + rng.Intn(10)
+
+		if rng.Intn(8) == 0 {
+			layout.Release(start, end)
+			for b := start; b < end; b++ {
+				reserved[b] = false
+			}
+			continue
+		}
+
+		free := true
+		for b := start; b < end; b++ {
+			free = free && !reserved[b]
+		}
+		if layout.IsFree(start, end) != free {
+			t.Fatal("IsFree", start, end, "should be", free)
+		}
 
-	insertionSort(regionsInputs)
+		requireFree := rng.Intn(4) != 0
+		if layout.Reserve(start, end, requireFree, "") != (free || !requireFree) {
+			t.Fatal("Reserve", start, end, "gave the wrong result")
+		}
+		if free || !requireFree {
+			for b := start; b < end; b++ {
+				reserved[b] = true
+			}
+		}
+	}
 
-	for k, v := range output {
-		if output[k] != regionsInputs[k].startPos {
-			t.Error("Position", k, "should have value", v, "has value", regionsInputs[k])
+	// the free regions are exactly the unreserved bytes
+	covered := make([]bool, len(reserved))
+	layout.ScanFreeRegions(func(start, end int) {
+		for b := start; b < end; b++ {
+			if reserved[b] || covered[b] {
+				t.Fatal("Byte", b, "should not be scanned as free")
+			}
+			covered[b] = true
 		}
+	}, len(reserved))
+	for b := range reserved {
+		if !reserved[b] && !covered[b] {
+			t.Fatal("Byte", b, "should be scanned as free")
+		}
+	}
+}
+
+func TestRangeReservationClone(t *testing.T) {
+	layout := NewRegionReservationStruct()
+	layout.Reserve(10, 20, true, "a")
+
+	clone := layout.Clone()
+	if !clone.Reserve(30, 40, true, "b") {
+		t.Error("Reserve should work")
+	}
+	if !layout.IsFree(30, 40) {
+		t.Error("Reserving in the clone should not change the original")
+	}
+	if !layout.Reserve(35, 45, true, "c") {
+		t.Error("Reserve should work")
+	}
+	if !clone.IsFree(40, 45) || clone.IsFree(30, 40) {
+		t.Error("Reserving in the original should not change the clone")
 	}
 }
 
@@ -130,3 +204,52 @@ func TestRangeReservation(t *testing.T) {
 		t.Error("Second free byteRangeForAllowedPositionIndex should be 203:1000, was", regions[1])
 	}
 }
+
+func TestRangeReservationRelease(t *testing.T) {
+	layout := NewRegionReservationStruct()
+	layout.Reserve(0, 12, true, "nonce")
+	layout.Reserve(12, 44, true, "suite")
+	layout.Reserve(30, 60, false, "hash")
+
+	if labels := layout.RegionsAt(35); len(labels) != 2 || labels[0] != "suite" || labels[1] != "hash" {
+		t.Error("RegionsAt(35) should be [suite hash], was", labels)
+	}
+	if labels := layout.RegionsAt(60); len(labels) != 0 {
+		t.Error("RegionsAt(60) should be empty, was", labels)
+	}
+
+	// releasing cuts the reservations, and keeps their labels
+	layout.Release(20, 50)
+	if !layout.IsFree(20, 50) || layout.IsFree(19, 20) || layout.IsFree(50, 51) {
+		t.Error("Only 20:50 should have been released")
+	}
+	regions := make([]string, 0)
+	for _, region := range layout.Regions() {
+		regions = append(regions, region.ToString())
+	}
+	expected := []string{"0:12 \"nonce\"", "12:20 \"suite\"", "50:60 \"hash\""}
+	if strings.Join(regions, ",") != strings.Join(expected, ",") {
+		t.Error("Regions should be", expected, "was", regions)
+	}
+
+	// iteration interleaves reserved and free regions
+	regions = make([]string, 0)
+	layout.Iterate(func(region Region, free bool) bool {
+		regions = append(regions, strconv.Itoa(region.Start())+":"+strconv.Itoa(region.End())+":"+strconv.FormatBool(free)+":"+region.Label())
+		return true
+	}, 100)
+	expected = []string{"0:12:false:nonce", "12:20:false:suite", "20:50:true:", "50:60:false:hash", "60:100:true:"}
+	if strings.Join(regions, ",") != strings.Join(expected, ",") {
+		t.Error("Iterate should give", expected, "was", regions)
+	}
+
+	// and stops when asked to
+	count := 0
+	layout.Iterate(func(region Region, free bool) bool {
+		count++
+		return !free
+	}, 100)
+	if count != 3 {
+		t.Error("Iterate should stop at the first free region, called", count, "times")
+	}
+}
@@ -0,0 +1,107 @@
+package purbs
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+
+	kyber "gopkg.in/dedis/kyber.v2"
+)
+
+// Largest cofactor among the supported groups. Multiplying a point by it sends every small-order point to the identity
+const MAX_COFACTOR = 8
+
+// Errors reported (wrapped in a RecipientError) when a recipient cannot be used to encode a PURB
+var (
+	ErrNoRecipients        = errors.New("no recipients given")
+	ErrMissingSuite        = errors.New("recipient has no suite")
+	ErrMissingPublicKey    = errors.New("recipient has no public key")
+	ErrUnknownSuite        = errors.New("suite is not in the SuiteInfoMap")
+	ErrWrongSuite          = errors.New("public key does not belong to the recipient's suite")
+	ErrIdentityPublicKey   = errors.New("public key is the identity element")
+	ErrSmallOrderPublicKey = errors.New("public key has a small order")
+	ErrDuplicateRecipient  = errors.New("recipient is listed more than once")
+)
+
+// RecipientError tells which recipient (by its index in the list given to Encode) is invalid, and why
+type RecipientError struct {
+	Index  int
+	Reason error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("recipient %d: %v", e.Index, e.Reason)
+}
+
+// Unwrap gives access to the reason, so that errors.Is(err, ErrDuplicateRecipient) and the like work
+func (e *RecipientError) Unwrap() error {
+	return e.Reason
+}
+
+// validateRecipients checks every recipient's suite and public key before anything is derived from them
+func validateRecipients(recipients []Recipient, infoMap SuiteInfoMap) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	// suiteName -> marshalled public key -> index of the first recipient using it
+	seen := make(map[string]map[string]int)
+
+	for index, recipient := range recipients {
+		if recipient.Suite == nil {
+			return &RecipientError{Index: index, Reason: ErrMissingSuite}
+		}
+		if recipient.PublicKey == nil {
+			return &RecipientError{Index: index, Reason: ErrMissingPublicKey}
+		}
+		if _, found := infoMap[recipient.SuiteName]; !found {
+			return &RecipientError{Index: index, Reason: fmt.Errorf("%w: %v", ErrUnknownSuite, recipient.SuiteName)}
+		}
+
+		keyBytes, err := checkPublicKey(recipient.Suite, recipient.PublicKey)
+		if err != nil {
+			return &RecipientError{Index: index, Reason: err}
+		}
+
+		if seen[recipient.SuiteName] == nil {
+			seen[recipient.SuiteName] = make(map[string]int)
+		}
+		keyHex := hex.EncodeToString(keyBytes)
+		if first, found := seen[recipient.SuiteName][keyHex]; found {
+			return &RecipientError{Index: index, Reason: fmt.Errorf("%w: same key as recipient %d", ErrDuplicateRecipient, first)}
+		}
+		seen[recipient.SuiteName][keyHex] = index
+	}
+	return nil
+}
+
+// checkPublicKey verifies that a public key is a point of the given suite, and that it is neither the identity nor
+// of small order. Returns the marshalled key
+func checkPublicKey(suite Suite, publicKey kyber.Point) ([]byte, error) {
+
+	// a point from another group has another concrete type, or does not unmarshal to the same point in this suite.
+	// Two suites sharing a point type (e.g., one curve with two hash functions) cannot be told apart here
+	if reflect.TypeOf(publicKey) != reflect.TypeOf(suite.Point()) {
+		return nil, ErrWrongSuite
+	}
+	keyBytes, err := publicKey.MarshalBinary()
+	if err != nil {
+		return nil, ErrWrongSuite
+	}
+	roundTrip := suite.Point()
+	if err := roundTrip.UnmarshalBinary(keyBytes); err != nil || !roundTrip.Equal(publicKey) {
+		return nil, ErrWrongSuite
+	}
+
+	if publicKey.Equal(suite.Point().Null()) {
+		return nil, ErrIdentityPublicKey
+	}
+
+	cofactor := suite.Scalar().SetInt64(MAX_COFACTOR)
+	if suite.Point().Mul(cofactor, publicKey).Equal(suite.Point().Null()) {
+		return nil, ErrSmallOrderPublicKey
+	}
+
+	return keyBytes, nil
+}
@@ -0,0 +1,79 @@
+package purbs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kyber "gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+// a point of some other group, as far as the type system is concerned
+type foreignPoint struct {
+	kyber.Point
+}
+
+func requireRecipientError(t *testing.T, err error, index int, reason error) {
+	require.Error(t, err)
+	recipientError, ok := err.(*RecipientError)
+	require.True(t, ok, "expected a RecipientError, got %v", err)
+	require.Equal(t, index, recipientError.Index)
+	require.True(t, errors.Is(err, reason), "expected %v, got %v", reason, err)
+}
+
+func TestValidateRecipients(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	params := NewPublicFixedParameters(infoMap, false)
+	data := []byte("SomeInfo")
+
+	_, err := Encode(data, nil, random.New(), params, false)
+	require.Equal(t, ErrNoRecipients, err)
+
+	recipients := createRecipients(3, 1, infoMap)
+	require.NoError(t, validateRecipients(recipients, infoMap))
+
+	unknownSuite := createRecipients(3, 1, infoMap)
+	unknownSuite[1].SuiteName = "nope"
+	_, err = Encode(data, unknownSuite, random.New(), params, false)
+	requireRecipientError(t, err, 1, ErrUnknownSuite)
+
+	missingKey := createRecipients(3, 1, infoMap)
+	missingKey[2].PublicKey = nil
+	requireRecipientError(t, validateRecipients(missingKey, infoMap), 2, ErrMissingPublicKey)
+
+	identity := createRecipients(3, 1, infoMap)
+	identity[0].PublicKey = identity[0].Suite.Point().Null()
+	requireRecipientError(t, validateRecipients(identity, infoMap), 0, ErrIdentityPublicKey)
+
+	wrongSuite := createRecipients(3, 1, infoMap)
+	wrongSuite[1].PublicKey = &foreignPoint{wrongSuite[1].PublicKey}
+	requireRecipientError(t, validateRecipients(wrongSuite, infoMap), 1, ErrWrongSuite)
+
+	duplicate := createRecipients(3, 1, infoMap)
+	duplicate[2].PublicKey = duplicate[0].PublicKey.Clone()
+	requireRecipientError(t, validateRecipients(duplicate, infoMap), 2, ErrDuplicateRecipient)
+}
+
+func TestValidateRecipientsSmallOrder(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	recipients := createRecipients(3, 1, infoMap)
+	suite := recipients[1].Suite
+
+	// the suites of the tests use the full group: multiplying a random point by the order of the prime-order subgroup
+	// (i.e., by -1, plus once more) leaves its small-order component
+	var smallOrder kyber.Point
+	for i := 0; i < 32 && smallOrder == nil; i++ {
+		point := suite.Point().Pick(random.New())
+		point = suite.Point().Add(suite.Point().Mul(suite.Scalar().Neg(suite.Scalar().One()), point), point)
+		if !point.Equal(suite.Point().Null()) {
+			smallOrder = point
+		}
+	}
+	if smallOrder == nil {
+		t.Skip("the suite has no point of small order")
+	}
+
+	recipients[1].PublicKey = smallOrder
+	requireRecipientError(t, validateRecipients(recipients, infoMap), 1, ErrSmallOrderPublicKey)
+}
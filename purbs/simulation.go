@@ -53,32 +53,33 @@ func SimulMeasureEncodingTime(nRepeat int, recipients []int, suites []int) strin
 					Nonce:            nil,
 					Header:           nil,
 					Payload:          nil,
-					SessionKey:       nil,
+					sessionKey:       nil,
 					Recipients:       recipients,
 					Stream:           random.New(),
-					OriginalData:     msg, // just for statistics
 					PublicParameters: publicFixedParams,
 					IsVerbose:        simulationIsVerbose,
 				}
 				purb.Nonce = purb.randomBytes(NONCE_LENGTH)
-				purb.SessionKey = purb.randomBytes(SYMMETRIC_KEY_LENGTH)
+				purb.sessionKey = purb.randomBytes(SYMMETRIC_KEY_LENGTH)
 
 				// creation of the entrypoints and cornerstones, places entrypoint and cornerstones
 				purb.Header = newEmptyHeader()
 
 				m.reset()
-				purb.createCornerstones()
+				if err := purb.createCornerstones(); err != nil {
+					panic(err.Error())
+				}
 				resultsPKGen.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.recordAndReset())
 
 				purb.createEntryPoints()
 				resultsSharedSecrets.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.recordAndReset())
 
-				purb.placeCornerstones()
+				if err := purb.placeCornerstones(); err != nil {
+					panic(err.Error())
+				}
 
-				if purb.PublicParameters.SimplifiedEntrypointsPlacement {
-					purb.placeEntrypointsSimplified()
-				} else {
-					purb.placeEntrypoints()
+				if err := purb.placeAllEntrypoints(); err != nil {
+					panic(err.Error())
 				}
 				resultsLayout.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.recordAndReset())
 
@@ -88,7 +89,9 @@ func SimulMeasureEncodingTime(nRepeat int, recipients []int, suites []int) strin
 				resultsPayload.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.recordAndReset())
 				// converts everything to []byte, performs the XOR trick on the cornerstones
 
-				purb.placePayloadAndCornerstones(purb.Stream)
+				if err := purb.placePayloadAndCornerstones(purb.Stream); err != nil {
+					panic(err.Error())
+				}
 
 				resultsHeaderEncrypt.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.recordAndReset())
 
@@ -131,6 +134,7 @@ func SimulMeasureWorstDecodingTime(nRepeat int, recipients []int, suites []int)
 	resultsPGPHidden := new(Results)
 	resultsPURBFlat := new(Results)
 	resultsPURB := new(Results)
+	resultsPURBCuckoo := new(Results)
 
 	m := newMonitor()
 	for _, nSuites := range suites {
@@ -213,6 +217,27 @@ func SimulMeasureWorstDecodingTime(nRepeat int, recipients []int, suites []int)
 				if err != nil {
 					panic(err.Error())
 				}
+
+				// -------------- PURBs cuckoo ----------------
+				si = createMultiInfo(nSuites)
+				decs = createMultiDecoders(nRecipients, nSuites, si)
+				publicFixedParams = NewCuckooPublicFixedParameters(si, nRecipients)
+
+				purb, err = Encode(msg, decs, random.New(), publicFixedParams, simulationIsVerbose)
+				if err != nil {
+					panic(err.Error())
+				}
+				blob = purb.ToBytes()
+
+				m.reset()
+				success, out, err = Decode(blob, &decs[len(decs)-1], publicFixedParams, simulationIsVerbose)
+				resultsPURBCuckoo.add(nRecipients, nSuites, k, -1, -1, nRepeat, m.record())
+				if !success || !bytes.Equal(out, msg) {
+					panic("PURBs-Cuckoo did not decrypt correctly")
+				}
+				if err != nil {
+					panic(err.Error())
+				}
 			}
 		}
 	}
@@ -221,7 +246,8 @@ func SimulMeasureWorstDecodingTime(nRepeat int, recipients []int, suites []int)
 	s += "\"pgp\": " + resultsPGP.String() + ","
 	s += "\"pgp-hidden\": " + resultsPGPHidden.String() + ","
 	s += "\"purb-flat\": " + resultsPURBFlat.String() + ","
-	s += "\"purb\": " + resultsPURB.String()
+	s += "\"purb\": " + resultsPURB.String() + ","
+	s += "\"purb-cuckoo\": " + resultsPURBCuckoo.String()
 	s += "}"
 	return s
 }
@@ -232,6 +258,7 @@ func SimulMeasureHeaderSize(nRepeat int, numRecipients []int) string {
 
 	resultsPURBs := new(Results)
 	resultsFlat := new(Results)
+	resultsCuckoo := new(Results)
 
 	si := createInfo()
 	key := make([]byte, SYMMETRIC_KEY_LENGTH)
@@ -252,15 +279,16 @@ func SimulMeasureHeaderSize(nRepeat int, numRecipients []int) string {
 				Nonce:            nonce,
 				Header:           nil,
 				Payload:          nil,
-				SessionKey:       key,
+				sessionKey:       key,
 				IsVerbose:        false,
 				Recipients:       decs,
 				Stream:           random.New(),
-				OriginalData:     nil,
 				PublicParameters: publicFixedParams,
 			}
 			p.PublicParameters.HashTableCollisionLinearResolutionAttempts = 3
-			p.CreateHeader()
+			if err := p.CreateHeader(); err != nil {
+				panic(err.Error())
+			}
 			value := float64(p.Header.Length())
 
 			resultsPURBs.add(nRecipients, -1, k, -1, -1, nRepeat, value)
@@ -271,23 +299,44 @@ func SimulMeasureHeaderSize(nRepeat int, numRecipients []int) string {
 				Nonce:            nonce,
 				Header:           nil,
 				Payload:          nil,
-				SessionKey:       key,
+				sessionKey:       key,
 				IsVerbose:        false,
 				Recipients:       decs,
 				Stream:           random.New(),
-				OriginalData:     nil,
 				PublicParameters: publicFixedParams,
 			}
-			p.CreateHeader()
+			if err := p.CreateHeader(); err != nil {
+				panic(err.Error())
+			}
 			value = float64(p.Header.Length())
 
 			resultsFlat.add(nRecipients, -1, k, -1, -1, nRepeat, value)
+
+			// cuckoo
+			publicFixedParams = NewCuckooPublicFixedParameters(si, nRecipients)
+			p = &Purb{
+				Nonce:            nonce,
+				Header:           nil,
+				Payload:          nil,
+				sessionKey:       key,
+				IsVerbose:        false,
+				Recipients:       decs,
+				Stream:           random.New(),
+				PublicParameters: publicFixedParams,
+			}
+			if err := p.CreateHeader(); err != nil {
+				panic(err.Error())
+			}
+			value = float64(p.Header.Length())
+
+			resultsCuckoo.add(nRecipients, -1, k, -1, -1, nRepeat, value)
 		}
 	}
 
 	s := "{"
 	s += "\"purb\": " + resultsPURBs.String() + ","
-	s += "\"purb-flat\": " + resultsFlat.String()
+	s += "\"purb-flat\": " + resultsFlat.String() + ","
+	s += "\"purb-cuckoo\": " + resultsCuckoo.String()
 	s += "}"
 	return s
 }
@@ -320,15 +369,16 @@ func SimulMeasureHeaderCompactness(nRepeat int, recipients []int, suites []int)
 					Nonce:            nonce,
 					Header:           nil,
 					Payload:          nil,
-					SessionKey:       key,
+					sessionKey:       key,
 					IsVerbose:        false,
 					Recipients:       decs,
 					Stream:           random.New(),
-					OriginalData:     nil,
 					PublicParameters: publicFixedParams,
 				}
 				p.PublicParameters.HashTableCollisionLinearResolutionAttempts = 3
-				p.CreateHeader()
+				if err := p.CreateHeader(); err != nil {
+					panic(err.Error())
+				}
 				accu := float64(0)
 				p.Header.Layout.ScanFreeRegions(func(low, high int) {
 					accu += float64(high - low)
@@ -378,57 +428,116 @@ func shiftByNONCE_LENGTH(pos []int) []int {
 	return res
 }
 
+// SimulMeasureAllowedPositions compares, for the first N suites of realSuiteDescriptions, the expected header length of
+// the hand-made AllowedPositions of createMultiInfoReal and of the ones computed by GenerateSuiteInfoMap
+func SimulMeasureAllowedPositions(suites []int) string {
+	l := log.New(os.Stderr, "", 0)
+
+	resultsHandmade := new(Results)
+	resultsGenerated := new(Results)
+
+	for _, nSuites := range suites {
+		descriptions := realSuiteDescriptions()[:nSuites]
+		l.Println("Simulating for", nSuites, "suites")
+
+		handmade := realSuiteInfoMap()
+		value, err := ExpectedHeaderLength(handmade, descriptions)
+		if err != nil {
+			panic(err.Error())
+		}
+		resultsHandmade.add(-1, nSuites, 0, -1, -1, 1, value)
+
+		generated, err := GenerateSuiteInfoMap(descriptions)
+		if err != nil {
+			panic(err.Error())
+		}
+		value, err = ExpectedHeaderLength(generated, descriptions)
+		if err != nil {
+			panic(err.Error())
+		}
+		resultsGenerated.add(-1, nSuites, 0, -1, -1, 1, value)
+
+		for _, description := range descriptions {
+			l.Println("  ", description.Name, generated[description.Name].AllowedPositions)
+		}
+	}
+
+	s := "{"
+	s += "\"handmade\": " + resultsHandmade.String() + ","
+	s += "\"generated\": " + resultsGenerated.String()
+	s += "}"
+	return s
+}
+
+// The suites of createMultiInfoReal
+func realSuiteDescriptions() []SuiteDescription {
+	return []SuiteDescription{
+		{Name: "PURB_A", CornerstoneLength: 64, EntryPointLength: ENTRYPOINT_LENGTH_32},
+		{Name: "PURB_B", CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_32},
+		{Name: "PURB_C", CornerstoneLength: 64, EntryPointLength: ENTRYPOINT_LENGTH_64},
+		{Name: "PURB_D", CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_64},
+		{Name: "PURB_E", CornerstoneLength: 64, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+		{Name: "PURB_F", CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+	}
+}
+
 func createMultiInfoReal(N int) SuiteInfoMap {
+	info := realSuiteInfoMap()
+
+	keys := make([]string, 0)
+	for k := range info {
+		keys = append(keys, k)
+	}
+	rand.Seed(time.Now().UTC().UnixNano())
+	for len(info) > N {
+		to_destroy := keys[rand.Intn(len(keys))]
+		delete(info, to_destroy)
+	}
+
+	return info
+}
+
+func realSuiteInfoMap() SuiteInfoMap {
 
 	// let's use the following suites
-	// PURB_A, cornerstone size 64, ep size 48, pos 0
-	// PURB_B, cornerstone size 32, ep size 48, pos 0, 64
-	// PURB_C, cornerstone size 64, ep size 80, pos 0, 64, 96
-	// PURB_D, cornerstone size 32, ep size 80, pos 0, 32, 64, 160
-	// PURB_E, cornerstone size 64, ep size 64, pos 0, 64, 128, 192
-	// PURB_F, cornerstone size 32, ep size 64, pos 0, 32, 64, 96, 128, 256
+	// PURB_A, cornerstone size 64, ep ENTRYPOINT_LENGTH_32, pos 0
+	// PURB_B, cornerstone size 32, ep ENTRYPOINT_LENGTH_32, pos 0, 64
+	// PURB_C, cornerstone size 64, ep ENTRYPOINT_LENGTH_64, pos 0, 64, 96
+	// PURB_D, cornerstone size 32, ep ENTRYPOINT_LENGTH_64, pos 0, 32, 64, 160
+	// PURB_E, cornerstone size 64, ep ENTRYPOINT_LENGTH_VERSIONED_32, pos 0, 64, 128, 192
+	// PURB_F, cornerstone size 32, ep ENTRYPOINT_LENGTH_VERSIONED_32, pos 0, 32, 64, 96, 128, 256
 
 	info := make(SuiteInfoMap)
 
 	info["PURB_A"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0}),
 		CornerstoneLength: 64,
-		EntryPointLength:  48,
+		EntryPointLength:  ENTRYPOINT_LENGTH_32,
 	}
 	info["PURB_B"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0, 64}),
 		CornerstoneLength: 32,
-		EntryPointLength:  48,
+		EntryPointLength:  ENTRYPOINT_LENGTH_32,
 	}
 	info["PURB_C"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0, 64, 96}),
 		CornerstoneLength: 64,
-		EntryPointLength:  80,
+		EntryPointLength:  ENTRYPOINT_LENGTH_64,
 	}
 	info["PURB_D"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0, 32, 64, 160}),
 		CornerstoneLength: 32,
-		EntryPointLength:  80,
+		EntryPointLength:  ENTRYPOINT_LENGTH_64,
 	}
 	info["PURB_E"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0, 64, 128, 192}),
 		CornerstoneLength: 64,
-		EntryPointLength:  64,
+		EntryPointLength:  ENTRYPOINT_LENGTH_VERSIONED_32,
 	}
 	info["PURB_F"] = &SuiteInfo{
 		AllowedPositions:  shiftByNONCE_LENGTH([]int{0, 32, 64, 96, 128, 256}),
 		CornerstoneLength: 32,
-		EntryPointLength:  64,
-	}
-
-	keys := make([]string, 0)
-	for k := range info {
-		keys = append(keys, k)
-	}
-	rand.Seed(time.Now().UTC().UnixNano())
-	for len(info) > N {
-		to_destroy := keys[rand.Intn(len(keys))]
-		delete(info, to_destroy)
+		EntryPointLength:  ENTRYPOINT_LENGTH_VERSIONED_32,
 	}
 
 	return info
@@ -0,0 +1,149 @@
+package purbs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	kyber "gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/group/curve25519"
+)
+
+// Errors of the suite registry
+var (
+	ErrUnregisteredSuite = errors.New("no suite is registered under this name")
+	ErrSuiteMismatch     = errors.New("suite differs from the one registered under its name")
+)
+
+// A suite implementation, and the defaults of its SuiteInfo
+type registeredSuite struct {
+	newSuite    func() Suite
+	description SuiteDescription
+}
+
+// The suites, by canonical name (see SUITE_CURVE25519 and the like). SUITE_CURVE25519 is built-in, other suites are
+// added with RegisterSuite
+var suiteRegistry = struct {
+	sync.RWMutex
+	suites map[string]*registeredSuite
+}{
+	suites: map[string]*registeredSuite{
+		SUITE_CURVE25519: {
+			newSuite:    func() Suite { return curve25519.NewBlakeSHA256Curve25519(true) },
+			description: SuiteDescription{Name: SUITE_CURVE25519, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH_VERSIONED_32},
+		},
+	},
+}
+
+// RegisterSuite registers a suite implementation under a canonical name. The suite's points must be hidable (see
+// kyber.Hiding), which gives the length of its cornerstones; entryPointLength is the default EntryPointLength of the
+// suite. A name cannot be registered twice
+func RegisterSuite(name string, newSuite func() Suite, entryPointLength int) error {
+	if name == "" {
+		return errors.New("empty suite name")
+	}
+	hiding, ok := newSuite().Point().(kyber.Hiding)
+	if !ok {
+		return fmt.Errorf("the points of suite %v cannot be hidden", name)
+	}
+	if _, _, err := entrypointLayout(entryPointLength); err != nil {
+		return err
+	}
+
+	suiteRegistry.Lock()
+	defer suiteRegistry.Unlock()
+	if _, found := suiteRegistry.suites[name]; found {
+		return fmt.Errorf("suite %v is already registered", name)
+	}
+	suiteRegistry.suites[name] = &registeredSuite{
+		newSuite:    newSuite,
+		description: SuiteDescription{Name: name, CornerstoneLength: hiding.HideLen(), EntryPointLength: entryPointLength},
+	}
+	return nil
+}
+
+// RegisteredSuites returns the names of the registered suites, sorted
+func RegisteredSuites() []string {
+	suiteRegistry.RLock()
+	defer suiteRegistry.RUnlock()
+	names := make([]string, 0, len(suiteRegistry.suites))
+	for name := range suiteRegistry.suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupSuite returns a new instance of the suite registered under this name
+func LookupSuite(name string) (Suite, error) {
+	registered, err := lookupRegisteredSuite(name)
+	if err != nil {
+		return nil, err
+	}
+	return registered.newSuite(), nil
+}
+
+// RegisteredSuiteInfoMap generates the SuiteInfoMap of registered suites, with their default lengths and the
+// AllowedPositions of GenerateSuiteInfoMap. Built-in profiles (see ProfileParameters) should be preferred, as PURBs
+// only interoperate with the same AllowedPositions
+func RegisteredSuiteInfoMap(names []string) (SuiteInfoMap, error) {
+	descriptions := make([]SuiteDescription, len(names))
+	for i, name := range names {
+		registered, err := lookupRegisteredSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		descriptions[i] = registered.description
+	}
+	return GenerateSuiteInfoMap(descriptions)
+}
+
+// CheckSuite checks that the recipient's Suite is the one registered under its SuiteName
+func (recipient *Recipient) CheckSuite() error {
+	registered, err := lookupRegisteredSuite(recipient.SuiteName)
+	if err != nil {
+		return err
+	}
+	if recipient.Suite == nil {
+		return ErrMissingSuite
+	}
+	expected := registered.newSuite()
+	if expected.String() != recipient.Suite.String() || reflect.TypeOf(expected.Point()) != reflect.TypeOf(recipient.Suite.Point()) {
+		return fmt.Errorf("%w: %v is %v, not %v", ErrSuiteMismatch, recipient.SuiteName, expected, recipient.Suite)
+	}
+	return nil
+}
+
+// CheckSuites checks that every suite of the parameters is registered, with the cornerstone length of its
+// implementation, e.g., after loading the parameters from a file
+func (params *PurbPublicFixedParameters) CheckSuites() error {
+	names := make([]string, 0, len(params.SuiteInfoMap))
+	for name := range params.SuiteInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		registered, err := lookupRegisteredSuite(name)
+		if err != nil {
+			return err
+		}
+		if length := params.SuiteInfoMap[name].CornerstoneLength; length != registered.description.CornerstoneLength {
+			return fmt.Errorf("%w: cornerstones of %v are %v bytes long, not %v", ErrSuiteMismatch, name,
+				registered.description.CornerstoneLength, length)
+		}
+	}
+	return nil
+}
+
+func lookupRegisteredSuite(name string) (*registeredSuite, error) {
+	suiteRegistry.RLock()
+	defer suiteRegistry.RUnlock()
+	registered, found := suiteRegistry.suites[name]
+	if !found {
+		return nil, fmt.Errorf("%w: %q", ErrUnregisteredSuite, name)
+	}
+	return registered, nil
+}
@@ -0,0 +1,63 @@
+package purbs
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/group/curve25519"
+	"gopkg.in/dedis/kyber.v2/util/key"
+)
+
+func TestSuiteRegistry(t *testing.T) {
+	require.Contains(t, RegisteredSuites(), SUITE_CURVE25519)
+	suite, err := LookupSuite(SUITE_CURVE25519)
+	require.NoError(t, err)
+	require.Equal(t, curve25519.NewBlakeSHA256Curve25519(true).String(), suite.String())
+
+	_, err = LookupSuite("curve0")
+	require.True(t, errors.Is(err, ErrUnregisteredSuite))
+
+	// the registry is global, so the name is fresh for every run of the test
+	name := "test-" + hex.EncodeToString(getRandomBytes(8))
+	newSuite := func() Suite { return curve25519.NewBlakeSHA256Curve25519(true) }
+	require.Error(t, RegisterSuite(name, newSuite, ENTRYPOINT_LENGTH_32+1))
+	require.NoError(t, RegisterSuite(name, newSuite, ENTRYPOINT_LENGTH_32))
+	require.Error(t, RegisterSuite(name, newSuite, ENTRYPOINT_LENGTH_32))
+	require.Contains(t, RegisteredSuites(), name)
+
+	infoMap, err := RegisteredSuiteInfoMap([]string{SUITE_CURVE25519, name})
+	require.NoError(t, err)
+	require.Equal(t, ENTRYPOINT_LENGTH_32, infoMap[name].EntryPointLength)
+	require.Equal(t, 32, infoMap[name].CornerstoneLength)
+	require.True(t, NewPublicFixedParameters(infoMap, false).Validate().OK())
+}
+
+func TestRecipientCheckSuite(t *testing.T) {
+	suite := curve25519.NewBlakeSHA256Curve25519(true)
+	pair := key.NewHidingKeyPair(suite)
+	recipient := Recipient{SuiteName: SUITE_CURVE25519, Suite: suite, PublicKey: pair.Public}
+	require.NoError(t, recipient.CheckSuite())
+
+	recipient.Suite = curve25519.NewBlakeSHA256Curve25519(false)
+	require.True(t, errors.Is(recipient.CheckSuite(), ErrSuiteMismatch))
+
+	// as the tests do, with a suffix
+	recipient.SuiteName = SUITE_CURVE25519 + "a"
+	require.True(t, errors.Is(recipient.CheckSuite(), ErrUnregisteredSuite))
+}
+
+func TestParametersCheckSuites(t *testing.T) {
+	params, err := ProfileParameters(PROFILE_CURVE25519_ONLY_V1)
+	require.NoError(t, err)
+	require.NoError(t, params.CheckSuites())
+
+	params.SuiteInfoMap[SUITE_CURVE25519].CornerstoneLength = 64
+	require.True(t, errors.Is(params.CheckSuites(), ErrSuiteMismatch))
+
+	// only curve25519 is built-in
+	params, err = ProfileParameters(PROFILE_MULTI_SUITE_V1)
+	require.NoError(t, err)
+	require.True(t, errors.Is(params.CheckSuites(), ErrUnregisteredSuite))
+}
@@ -4,38 +4,37 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
+	kyber "gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/group/curve25519"
 	"gopkg.in/dedis/kyber.v2/util/random"
 )
 
-// Simply returns a string with the internal details of the PURB
-func (purb *Purb) VisualRepresentation(withBoundaries bool) string {
+// Simply returns a string with the public details of the PURB's layout
+func (encoded *EncodedPurb) VisualRepresentation(withBoundaries bool) string {
 
 	lines := make([]string, 0)
 
-	verbose := purb.IsVerbose
-	purb.IsVerbose = false
-	bytes := purb.ToBytes() // we don't want this to be verbose
-	purb.IsVerbose = verbose
+	bytes := encoded.ToBytes()
+	suiteInfoMap := encoded.PublicParameters.SuiteInfoMap
 
 	lines = append(lines, "*** PURB Details ***")
-	lines = append(lines, fmt.Sprintf("Original Data: len %v", len(purb.OriginalData)))
-	lines = append(lines, fmt.Sprintf("PURB: header at 0 (len %v), payload at %v (len %v), total %v bytes", purb.Header.Length(), purb.Header.Length(), len(purb.Payload), len(bytes)))
+	lines = append(lines, fmt.Sprintf("PURB: header at 0 (len %v), payload at %v (len %v), total %v bytes", encoded.HeaderLength, encoded.HeaderLength, encoded.PayloadLength, len(bytes)))
 
-	lines = append(lines, fmt.Sprintf("Nonce: %+v (len %v)", purb.Nonce, len(purb.Nonce)))
+	lines = append(lines, fmt.Sprintf("Nonce: %+v (len %v)", bytes[:NONCE_LENGTH], NONCE_LENGTH))
 
-	for _, cornerstone := range purb.Header.Cornerstones {
-		lines = append(lines, fmt.Sprintf("Cornerstones: %+v @ offset %v (len %v)", cornerstone.SuiteName, cornerstone.Offset, purb.PublicParameters.SuiteInfoMap[cornerstone.SuiteName].CornerstoneLength))
-
-		lines = append(lines, fmt.Sprintf("  Value: %v", cornerstone.Bytes))
-		lines = append(lines, fmt.Sprintf("  Allowed positions for this suite: %v", purb.PublicParameters.SuiteInfoMap[cornerstone.SuiteName].AllowedPositions))
+	for _, cornerstone := range encoded.Cornerstones {
+		lines = append(lines, fmt.Sprintf("Cornerstones: %+v @ offset %v (len %v)", cornerstone.SuiteName, cornerstone.Offset, cornerstone.Length))
+		lines = append(lines, fmt.Sprintf("  Allowed positions for this suite: %v", suiteInfoMap[cornerstone.SuiteName].AllowedPositions))
 
 		cornerstoneStartPosUsed := make([]int, 0)
-		for _, startPos := range purb.PublicParameters.SuiteInfoMap[cornerstone.SuiteName].AllowedPositions {
+		for _, startPos := range suiteInfoMap[cornerstone.SuiteName].AllowedPositions {
 			if startPos < len(bytes) {
 				cornerstoneStartPosUsed = append(cornerstoneStartPosUsed, startPos)
 			}
@@ -44,7 +43,7 @@ func (purb *Purb) VisualRepresentation(withBoundaries bool) string {
 		cornerstoneRangesUsed := make([]string, 0)
 		cornerstoneRangesValues := make([][]byte, 0)
 		for _, startPos := range cornerstoneStartPosUsed {
-			endPos := startPos + purb.PublicParameters.SuiteInfoMap[cornerstone.SuiteName].CornerstoneLength
+			endPos := startPos + cornerstone.Length
 			if endPos > len(bytes) {
 				endPos = len(bytes)
 			}
@@ -53,8 +52,8 @@ func (purb *Purb) VisualRepresentation(withBoundaries bool) string {
 		}
 		lines = append(lines, fmt.Sprintf("  Positions used: %v", cornerstoneRangesUsed))
 
-		xor := make([]byte, len(cornerstoneRangesValues[0]))
-		// XORed, those values should give back the cornerstone value
+		xor := make([]byte, cornerstone.Length)
+		// XORed, those values give back the (hidden-encoded) cornerstone value
 		for i := range cornerstoneRangesValues {
 			lines = append(lines, fmt.Sprintf("  Value @ pos[%v]: %v", cornerstoneRangesUsed[i], cornerstoneRangesValues[i]))
 
@@ -66,15 +65,12 @@ func (purb *Purb) VisualRepresentation(withBoundaries bool) string {
 		lines = append(lines, fmt.Sprintf("  Recomputed value: %v", xor))
 
 	}
-	for suiteName, entrypoints := range purb.Header.EntryPoints {
-		lines = append(lines, fmt.Sprintf("Entrypoints for suite %v", suiteName))
-		for index, entrypoint := range entrypoints {
-			lines = append(lines, fmt.Sprintf("  Entrypoints [%v]: %+v @ offset %v (len %v)", index, entrypoint.SharedSecret, entrypoint.Offset, entrypoint.Length))
-		}
+	for index, entrypoint := range encoded.EntryPoints {
+		lines = append(lines, fmt.Sprintf("Entrypoints [%v]: suite %v @ offset %v (len %v)", index, entrypoint.SuiteName, entrypoint.Offset, entrypoint.Length))
 	}
-	lines = append(lines, fmt.Sprintf("Padded Payload: %+v @ offset %v (len %v)", purb.Payload, purb.Header.Length(), len(purb.Payload)))
+	lines = append(lines, fmt.Sprintf("Padded Payload: %+v @ offset %v (len %v)", bytes[encoded.HeaderLength:encoded.HeaderLength+encoded.PayloadLength], encoded.HeaderLength, encoded.PayloadLength))
 
-	lines = append(lines, fmt.Sprintf("MAC: %+v @ offset %v (len %v)", getMAC(purb.byteRepresentation), len(purb.byteRepresentation)-MAC_AUTHENTICATION_TAG_LENGTH, MAC_AUTHENTICATION_TAG_LENGTH))
+	lines = append(lines, fmt.Sprintf("MAC: %+v @ offset %v (len %v)", getMAC(bytes), len(bytes)-MAC_AUTHENTICATION_TAG_LENGTH, MAC_AUTHENTICATION_TAG_LENGTH))
 
 	if !withBoundaries {
 		return strings.Join(lines, "\n")
@@ -160,6 +156,45 @@ func streamDecrypt(ciphertext, key []byte) []byte {
 	return data
 }
 
+// Overwrites a secret byte slice with zeros
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Overwrites a secret scalar with zero
+func zeroScalar(s kyber.Scalar) {
+	if s != nil {
+		s.Zero()
+	}
+}
+
+// Calls f(0), ..., f(n-1) from the given number of goroutines, and returns once all calls are done
+func parallelFor(n int, workers int, f func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			for i := first; i < n; i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
 // KDF derives a key from a purpose string and seed bytes
 func KDF(purpose string, seed []byte) []byte {
 	h := sha256.New()
@@ -181,3 +216,32 @@ func (si SuiteInfo) String() string {
 
 	return s + "]"
 }
+
+func (mode EntrypointsPlacementMode) String() string {
+	switch mode {
+	case PlacementHashTable:
+		return "hash-table"
+	case PlacementSimplified:
+		return "simplified"
+	case PlacementCuckoo:
+		return "cuckoo"
+	}
+	return "unknown(" + strconv.Itoa(int(mode)) + ")"
+}
+
+// appendLengthPrefixed appends the value, prefixed with its length as a uvarint
+func appendLengthPrefixed(b []byte, value []byte) []byte {
+	length := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(length, uint64(len(value)))
+	b = append(b, length[:n]...)
+	return append(b, value...)
+}
+
+// readLengthPrefixed reads a value written by appendLengthPrefixed, and returns it and what follows
+func readLengthPrefixed(b []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(b)
+	if n <= 0 || length > uint64(len(b)-n) {
+		return nil, nil, errors.New("truncated length-prefixed value")
+	}
+	return b[n : n+int(length)], b[n+int(length):], nil
+}
@@ -0,0 +1,438 @@
+package purbs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Up to this number of suites, Validate simulates the MAC placement for every subset of suites; above, only for each
+// suite alone and for all suites together
+const MAX_SUITES_EXHAUSTIVE_MAC_CHECK = 8
+
+// Validate warns when the re-padding needed to keep the MAC off the cornerstone positions makes a PURB this much
+// larger (relatively) than the padding scheme alone would
+const MAX_MAC_REPADDING_OVERHEAD = 0.12
+
+// How bad a ValidationIssue is
+type ValidationSeverity int
+
+const (
+	// The parameters work, but are probably not what was intended
+	SeverityWarning ValidationSeverity = iota
+	// Encoding or decoding will fail, or produce broken PURBs
+	SeverityError
+)
+
+func (s ValidationSeverity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// What a ValidationIssue is about
+type ValidationIssueKind int
+
+const (
+	IssueNoSuites           ValidationIssueKind = iota // the SuiteInfoMap is empty
+	IssueMissingSuiteInfo                              // a suite is mapped to nil
+	IssueInvalidLength                                 // a cornerstone length is not positive
+	IssueNoAllowedPositions                            // a suite has no allowed position
+	IssueNegativePosition                              // an allowed position is negative
+	IssueUnsortedPositions                             // the allowed positions are not in increasing order
+	IssueNonceOverlap                                  // an allowed position overlaps the nonce, it can never hold the cornerstone
+	IssueSelfOverlap                                   // two allowed positions of the same suite overlap, which breaks the XOR of the cornerstone
+	IssueEntryPointLength                              // EntryPointLength is not the size of an encrypted entrypoint, with 32-bit or 64-bit pointers
+	IssueHashTableAttempts                             // HashTableCollisionLinearResolutionAttempts is not positive
+	IssueCuckooBound                                   // CuckooMaxEntrypoints is not positive
+	IssuePlacementMode                                 // the entrypoints placement mode is unknown
+	IssueUnplaceableSubset                             // the cornerstones of these suites cannot be placed together
+	IssueMACRepadding                                  // keeping the MAC off the cornerstone positions costs a lot of padding
+	IssueHeaderPadding                                 // the header padding scheme or the cover recipients are invalid
+	IssuePadding                                       // the padding scheme is invalid
+)
+
+func (k ValidationIssueKind) String() string {
+	switch k {
+	case IssueNoSuites:
+		return "no-suites"
+	case IssueMissingSuiteInfo:
+		return "missing-suite-info"
+	case IssueInvalidLength:
+		return "invalid-length"
+	case IssueNoAllowedPositions:
+		return "no-allowed-positions"
+	case IssueNegativePosition:
+		return "negative-position"
+	case IssueUnsortedPositions:
+		return "unsorted-positions"
+	case IssueNonceOverlap:
+		return "nonce-overlap"
+	case IssueSelfOverlap:
+		return "self-overlap"
+	case IssueEntryPointLength:
+		return "entrypoint-length"
+	case IssueHashTableAttempts:
+		return "hash-table-attempts"
+	case IssueCuckooBound:
+		return "cuckoo-bound"
+	case IssuePlacementMode:
+		return "placement-mode"
+	case IssueUnplaceableSubset:
+		return "unplaceable-subset"
+	case IssueMACRepadding:
+		return "mac-repadding"
+	case IssueHeaderPadding:
+		return "header-padding"
+	case IssuePadding:
+		return "padding"
+	}
+	return "unknown"
+}
+
+// One problem found by Validate
+type ValidationIssue struct {
+	Kind     ValidationIssueKind
+	Severity ValidationSeverity
+	Suites   []string // the suites concerned, sorted; empty if the issue is not about specific suites
+	Message  string
+}
+
+func (issue ValidationIssue) String() string {
+	if len(issue.Suites) == 0 {
+		return fmt.Sprintf("%v [%v]: %v", issue.Severity, issue.Kind, issue.Message)
+	}
+	return fmt.Sprintf("%v [%v] %v: %v", issue.Severity, issue.Kind, strings.Join(issue.Suites, ","), issue.Message)
+}
+
+// Result of Validate
+type ValidationReport struct {
+	Issues []ValidationIssue
+}
+
+// OK returns true if there is no error (there can be warnings)
+func (report *ValidationReport) OK() bool {
+	return len(report.Errors()) == 0
+}
+
+// Errors returns the issues of SeverityError
+func (report *ValidationReport) Errors() []ValidationIssue {
+	return report.withSeverity(SeverityError)
+}
+
+// Warnings returns the issues of SeverityWarning
+func (report *ValidationReport) Warnings() []ValidationIssue {
+	return report.withSeverity(SeverityWarning)
+}
+
+// Err returns nil if there is no error, and an error summarizing them otherwise
+func (report *ValidationReport) Err() error {
+	errs := report.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, issue := range errs {
+		messages[i] = issue.String()
+	}
+	return errors.New("invalid PURB parameters: " + strings.Join(messages, "; "))
+}
+
+func (report *ValidationReport) String() string {
+	if len(report.Issues) == 0 {
+		return "ok"
+	}
+	lines := make([]string, len(report.Issues))
+	for i, issue := range report.Issues {
+		lines[i] = issue.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (report *ValidationReport) withSeverity(severity ValidationSeverity) []ValidationIssue {
+	issues := make([]ValidationIssue, 0)
+	for _, issue := range report.Issues {
+		if issue.Severity == severity {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func (report *ValidationReport) add(kind ValidationIssueKind, severity ValidationSeverity, suites []string, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, ValidationIssue{
+		Kind:     kind,
+		Severity: severity,
+		Suites:   suites,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the parameters before they are used to encode or decode PURBs. It checks each suite on its own (its
+// allowed positions and lengths), that the cornerstones of every subset of suites can be placed, and simulates the
+// MAC placement to find suites whose positions cost a lot of re-padding. It is meant to be called once, when the
+// parameters are built, as checking every subset is exponential in the number of suites.
+func (params *PurbPublicFixedParameters) Validate() *ValidationReport {
+	report := new(ValidationReport)
+
+	switch params.EntrypointsPlacement {
+	case PlacementHashTable:
+		if params.HashTableCollisionLinearResolutionAttempts < 1 {
+			report.add(IssueHashTableAttempts, SeverityError, nil,
+				"HashTableCollisionLinearResolutionAttempts is %v, entrypoints could never be placed", params.HashTableCollisionLinearResolutionAttempts)
+		}
+	case PlacementSimplified:
+	case PlacementCuckoo:
+		if params.CuckooMaxEntrypoints < 1 {
+			report.add(IssueCuckooBound, SeverityError, nil,
+				"CuckooMaxEntrypoints is %v, entrypoints could never be placed", params.CuckooMaxEntrypoints)
+		}
+	default:
+		report.add(IssuePlacementMode, SeverityError, nil, "unknown entrypoints placement mode %v", params.EntrypointsPlacement)
+	}
+
+	validatePadding(report, params)
+
+	if len(params.SuiteInfoMap) == 0 {
+		report.add(IssueNoSuites, SeverityError, nil, "no suite defined")
+		return report
+	}
+
+	names := make([]string, 0, len(params.SuiteInfoMap))
+	for name := range params.SuiteInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// only the suites without errors take part in the placement checks
+	valid := make([]string, 0, len(names))
+	for _, name := range names {
+		if validateSuiteInfo(report, name, params.SuiteInfoMap[name]) {
+			valid = append(valid, name)
+		}
+	}
+
+	infos := make([]*SuiteInfo, len(valid))
+	for i, name := range valid {
+		infos[i] = params.SuiteInfoMap[name]
+	}
+	validatePlacement(report, valid, infos, params.paddingScheme())
+
+	return report
+}
+
+// validateSuiteInfo checks one suite, and returns false if it has errors
+func validateSuiteInfo(report *ValidationReport, name string, info *SuiteInfo) bool {
+	suites := []string{name}
+	if info == nil {
+		report.add(IssueMissingSuiteInfo, SeverityError, suites, "no SuiteInfo")
+		return false
+	}
+
+	errorsBefore := len(report.Errors())
+
+	if info.CornerstoneLength <= 0 {
+		report.add(IssueInvalidLength, SeverityError, suites, "cornerstone length is %v", info.CornerstoneLength)
+	}
+
+	if _, _, err := entrypointLayout(info.EntryPointLength); err != nil {
+		report.add(IssueEntryPointLength, SeverityError, suites,
+			"entrypoint length is %v, but encrypted entrypoints are %v or %v (32-bit pointers), %v or %v (64-bit pointers) bytes long",
+			info.EntryPointLength, ENTRYPOINT_LENGTH_32, ENTRYPOINT_LENGTH_VERSIONED_32, ENTRYPOINT_LENGTH_64, ENTRYPOINT_LENGTH_VERSIONED_64)
+	}
+
+	if len(info.AllowedPositions) == 0 {
+		report.add(IssueNoAllowedPositions, SeverityError, suites, "no allowed position")
+	}
+
+	if !sort.IntsAreSorted(info.AllowedPositions) {
+		report.add(IssueUnsortedPositions, SeverityWarning, suites, "allowed positions %v are not sorted", info.AllowedPositions)
+	}
+
+	usable := 0
+	for i, start := range info.AllowedPositions {
+		end := start + info.CornerstoneLength
+		if start < 0 {
+			report.add(IssueNegativePosition, SeverityError, suites, "allowed position %v is negative", start)
+			continue
+		}
+		if start < NONCE_LENGTH {
+			report.add(IssueNonceOverlap, SeverityWarning, suites,
+				"allowed position [%v:%v] overlaps the nonce, it will never hold the cornerstone", start, end)
+		} else {
+			usable++
+		}
+		for _, otherStart := range info.AllowedPositions[i+1:] {
+			if start < otherStart+info.CornerstoneLength && otherStart < end {
+				report.add(IssueSelfOverlap, SeverityError, suites, "allowed positions %v and %v overlap", start, otherStart)
+			}
+		}
+	}
+	if len(info.AllowedPositions) > 0 && usable == 0 {
+		report.add(IssueNonceOverlap, SeverityError, suites, "every allowed position overlaps the nonce")
+	}
+
+	return len(report.Errors()) == errorsBefore
+}
+
+// validatePlacement checks that the cornerstones of every subset of suites can be placed, and how the MAC placement
+// interacts with the allowed positions
+func validatePlacement(report *ValidationReport, names []string, infos []*SuiteInfo, scheme PaddingScheme) {
+	if len(names) == 0 {
+		return
+	}
+
+	// if a set of suites can be placed, so can its subsets (removing a suite only removes constraints on the others):
+	// above the size of the exact search, it is enough to check all the suites together
+	problem := &placementProblem{suites: infos}
+	if len(names) > MAX_SUITES_EXACT_CORNERSTONE_PLACEMENT {
+		if _, _, err := problem.solveGreedy(); err != nil {
+			report.add(IssueUnplaceableSubset, SeverityError, names, "the cornerstones of these suites cannot be placed together")
+			return
+		}
+		if len(names) <= 64 { // sets of suites are bitmasks
+			validateMACPlacement(report, names, infos, nil, scheme)
+		}
+		return
+	}
+
+	// report the smallest subsets that cannot be placed
+	table := problem.table()
+	for set := uint64(1); set < uint64(len(table.best)); set++ {
+		if table.best[set] != infeasiblePlacement {
+			continue
+		}
+		minimal := true
+		for s := uint(0); s < uint(len(names)); s++ {
+			if set&(1<<s) != 0 && table.best[set&^(1<<s)] == infeasiblePlacement {
+				minimal = false
+				break
+			}
+		}
+		if minimal {
+			report.add(IssueUnplaceableSubset, SeverityError, namesInSet(names, set),
+				"the cornerstones of these suites cannot be placed together")
+		}
+	}
+
+	validateMACPlacement(report, names, infos, table, scheme)
+}
+
+// validateMACPlacement replays the padding of payloads of every length for which the MAC could overlap an allowed
+// position, assuming one recipient per suite, and warns when the re-padding costs more than MAX_MAC_REPADDING_OVERHEAD
+func validateMACPlacement(report *ValidationReport, names []string, infos []*SuiteInfo, table *placementTable, scheme PaddingScheme) {
+	n := uint(len(names))
+	full := uint64(1)<<n - 1
+
+	sets := make([]uint64, 0)
+	if n <= MAX_SUITES_EXHAUSTIVE_MAC_CHECK {
+		for set := uint64(1); set <= full; set++ {
+			sets = append(sets, set)
+		}
+	} else {
+		for s := uint(0); s < n; s++ {
+			sets = append(sets, 1<<s)
+		}
+		sets = append(sets, full)
+	}
+
+	for _, set := range sets {
+		headerLength := packedHeaderLength(infos, set)
+		if table != nil {
+			if table.best[set] == infeasiblePlacement {
+				continue
+			}
+			if table.best[set] > headerLength {
+				headerLength = table.best[set]
+			}
+		}
+
+		macOverlaps := func(macStart, macEnd int) bool {
+			return overlapsAllowedPositions(infos, set, macStart, macEnd)
+		}
+
+		// beyond the last allowed position, the MAC cannot overlap anything
+		lastEnd := 0
+		for s := uint(0); s < n; s++ {
+			if set&(1<<s) == 0 {
+				continue
+			}
+			for _, start := range infos[s].AllowedPositions {
+				if start+infos[s].CornerstoneLength > lastEnd {
+					lastEnd = start + infos[s].CornerstoneLength
+				}
+			}
+		}
+
+		worstOverhead, worstLength := float64(0), 0
+		for encryptedLength := 1; headerLength+encryptedLength < lastEnd; encryptedLength++ {
+			plain := paddedPayloadLength(encryptedLength, headerLength, scheme, func(int, int) bool { return false })
+			repadded := paddedPayloadLength(encryptedLength, headerLength, scheme, macOverlaps)
+			overhead := float64(repadded-plain) / float64(headerLength+plain+MAC_AUTHENTICATION_TAG_LENGTH)
+			if overhead > worstOverhead {
+				worstOverhead, worstLength = overhead, encryptedLength
+			}
+		}
+
+		if worstOverhead > MAX_MAC_REPADDING_OVERHEAD {
+			report.add(IssueMACRepadding, SeverityWarning, namesInSet(names, set),
+				"keeping the MAC off the allowed positions makes a PURB with a %v-byte payload %.0f%% larger",
+				worstLength, 100*worstOverhead)
+		}
+	}
+}
+
+// validatePadding checks the padding schemes and the cover recipients
+func validatePadding(report *ValidationReport, params *PurbPublicFixedParameters) {
+	if err := validatePaddingScheme(params.paddingScheme()); err != nil {
+		report.add(IssuePadding, SeverityError, nil, "PaddingScheme %v: %v", params.paddingScheme(), err)
+	}
+	if err := validatePaddingScheme(params.headerPaddingScheme()); err != nil {
+		report.add(IssueHeaderPadding, SeverityError, nil, "HeaderPaddingScheme %v: %v", params.headerPaddingScheme(), err)
+	}
+	if params.HeaderCoverRecipients < 0 {
+		report.add(IssueHeaderPadding, SeverityError, nil, "HeaderCoverRecipients is %v", params.HeaderCoverRecipients)
+	}
+}
+
+// packedHeaderLength is the length of a header holding, right after the nonce, one cornerstone and one entrypoint for
+// each suite of the set
+func packedHeaderLength(infos []*SuiteInfo, set uint64) int {
+	length := NONCE_LENGTH
+	for s := range infos {
+		if set&(1<<uint(s)) != 0 {
+			length += infos[s].CornerstoneLength + infos[s].EntryPointLength
+		}
+	}
+	return length
+}
+
+// overlapsAllowedPositions returns true iff [start, end[ overlaps an allowed position of a suite of the set
+func overlapsAllowedPositions(infos []*SuiteInfo, set uint64, start, end int) bool {
+	for s, info := range infos {
+		if set&(1<<uint(s)) == 0 {
+			continue
+		}
+		for _, pos := range info.AllowedPositions {
+			if start < pos+info.CornerstoneLength && pos < end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func namesInSet(names []string, set uint64) []string {
+	res := make([]string, 0)
+	for i, name := range names {
+		if set&(1<<uint(i)) != 0 {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+package purbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// returns the issues of this kind
+func issuesOfKind(report *ValidationReport, kind ValidationIssueKind) []ValidationIssue {
+	issues := make([]ValidationIssue, 0)
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func TestValidate(t *testing.T) {
+	for _, nSuites := range []int{1, 3, 5} {
+		report := NewPublicFixedParameters(getDummySuiteInfo(nSuites), false).Validate()
+		require.True(t, report.OK(), report.String())
+		require.NoError(t, report.Err())
+	}
+
+	infoMap, err := GenerateSuiteInfoMap(realSuiteDescriptions())
+	require.NoError(t, err)
+	report := NewPublicFixedParameters(infoMap, true).Validate()
+	require.True(t, report.OK(), report.String())
+
+	report = NewPublicFixedParameters(realSuiteInfoMap(), true).Validate()
+	require.Empty(t, issuesOfKind(report, IssueEntryPointLength), report.String())
+}
+
+func TestValidateSuiteInfo(t *testing.T) {
+	infoMap := getDummySuiteInfo(1)
+	for _, info := range infoMap {
+		info.AllowedPositions = append(info.AllowedPositions, -50)
+	}
+	infoMap["nil"] = nil
+	infoMap["empty"] = &SuiteInfo{CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH}
+	infoMap["messy"] = &SuiteInfo{
+		AllowedPositions:  []int{200, 0, 100, 120},
+		CornerstoneLength: 32,
+		EntryPointLength:  ENTRYPOINT_LENGTH + 4,
+	}
+	params := NewPublicFixedParameters(infoMap, false)
+	params.HashTableCollisionLinearResolutionAttempts = 0
+
+	report := params.Validate()
+	require.False(t, report.OK())
+	require.Error(t, report.Err())
+
+	require.Len(t, issuesOfKind(report, IssueMissingSuiteInfo), 1)
+	require.Equal(t, []string{"nil"}, issuesOfKind(report, IssueMissingSuiteInfo)[0].Suites)
+	require.Len(t, issuesOfKind(report, IssueNoAllowedPositions), 1)
+	require.Len(t, issuesOfKind(report, IssueNegativePosition), 1)
+	require.Len(t, issuesOfKind(report, IssueHashTableAttempts), 1)
+	require.Len(t, issuesOfKind(report, IssueEntryPointLength), 1)
+	require.Equal(t, []string{"messy"}, issuesOfKind(report, IssueEntryPointLength)[0].Suites)
+	require.Len(t, issuesOfKind(report, IssueUnsortedPositions), 2)
+	require.Len(t, issuesOfKind(report, IssueSelfOverlap), 1)
+
+	nonceOverlap := issuesOfKind(report, IssueNonceOverlap)
+	require.Len(t, nonceOverlap, 1)
+	require.Equal(t, SeverityWarning, nonceOverlap[0].Severity)
+}
+
+func TestValidateUnplaceable(t *testing.T) {
+	infoMap := getDummySuiteInfo(3)
+	names := make([]string, 0)
+	for name, info := range infoMap {
+		names = append(names, name)
+		info.AllowedPositions = []int{NONCE_LENGTH + 64*len(names)}
+	}
+	// two suites sharing their only position
+	infoMap[names[0]].AllowedPositions = []int{NONCE_LENGTH}
+	infoMap[names[1]].AllowedPositions = []int{NONCE_LENGTH}
+
+	report := NewPublicFixedParameters(infoMap, false).Validate()
+	unplaceable := issuesOfKind(report, IssueUnplaceableSubset)
+	require.Len(t, unplaceable, 1, report.String())
+	require.Equal(t, SeverityError, unplaceable[0].Severity)
+	require.ElementsMatch(t, names[:2], unplaceable[0].Suites)
+}
+
+func TestValidateMACRepadding(t *testing.T) {
+	// a single suite with positions everywhere: the MAC must jump over them
+	positions := make([]int, 0)
+	for pos := NONCE_LENGTH; pos < 2000; pos += 64 {
+		positions = append(positions, pos)
+	}
+	infoMap := SuiteInfoMap{"spread": {AllowedPositions: positions, CornerstoneLength: 32, EntryPointLength: ENTRYPOINT_LENGTH}}
+
+	report := NewPublicFixedParameters(infoMap, false).Validate()
+	require.True(t, report.OK())
+	repadding := issuesOfKind(report, IssueMACRepadding)
+	require.Len(t, repadding, 1, report.String())
+	require.Equal(t, SeverityWarning, repadding[0].Severity)
+}